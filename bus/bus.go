@@ -0,0 +1,85 @@
+// Package kvbus defines the invalidation bus that keeps the local tiers of kvtiered stores
+// in sync across instances, and an in-process implementation of it.
+package kvbus
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+// Invalidation lists the keys whose local copies must be evicted after a write.
+type Invalidation struct {
+	// Source identifies the instance that made the write, so it can skip its own messages.
+	Source string `json:"source,omitempty"`
+	// Keys are evicted one by one.
+	Keys []string `json:"keys,omitempty"`
+	// Patterns are evicted with DeleteByPattern.
+	Patterns []string `json:"patterns,omitempty"`
+}
+
+// InvalidateAll returns an Invalidation that evicts every key. Buses send it to their
+// subscribers after a reconnect, since messages published while disconnected are lost.
+func InvalidateAll() Invalidation {
+	return Invalidation{Patterns: []string{"*"}}
+}
+
+func (i Invalidation) MarshalBinary() ([]byte, error) {
+	return json.Marshal(i)
+}
+
+func (i *Invalidation) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, i)
+}
+
+// Bus broadcasts invalidations between instances of kvtiered.Tiered sharing the same remote tier,
+// so a write through one instance evicts the key from the local tier of every other one.
+type Bus interface {
+	Publish(ctx context.Context, msg Invalidation) error
+	// Subscribe calls handler for every message published on the bus until the returned
+	// function is called. Connection errors are retried by the bus.
+	Subscribe(handler func(Invalidation)) (unsubscribe func())
+}
+
+var _ Bus = (*LocalBus)(nil)
+
+// LocalBus is an in-process Bus delivering messages synchronously.
+// It is meant for tests and for several kvtiered.Tiered instances within one process.
+type LocalBus struct {
+	mu       sync.RWMutex
+	handlers map[uint64]func(Invalidation)
+	next     uint64
+}
+
+func NewLocalBus() *LocalBus {
+	return &LocalBus{
+		handlers: make(map[uint64]func(Invalidation)),
+	}
+}
+
+func (b *LocalBus) Publish(_ context.Context, msg Invalidation) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, handler := range b.handlers {
+		handler(msg)
+	}
+
+	return nil
+}
+
+func (b *LocalBus) Subscribe(handler func(Invalidation)) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.next
+	b.next++
+	b.handlers[id] = handler
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		delete(b.handlers, id)
+	}
+}
@@ -0,0 +1,201 @@
+package kvcodec
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	kvscanner "github.com/twirapp/kv/scanner"
+)
+
+// Codec converts values to and from the bytes kept in a store.
+// Every store uses Default unless another Codec is configured, so a value written
+// through one backend reads back the same through any other.
+type Codec interface {
+	Marshal(value any) ([]byte, error)
+	Unmarshal(data []byte, dest any) error
+}
+
+// Default is the codec used by every store unless configured otherwise.
+var Default Codec = Text{}
+
+var _ Codec = Text{}
+
+// Text encodes scalars as human-readable text, the same way go-redis writes command arguments:
+// integers and floats in decimal, bools as "1" or "0", time.Time in RFC 3339 with nanoseconds and
+// time.Duration as integer nanoseconds. Values implementing encoding.BinaryMarshaler use it, and
+// anything else is encoded as JSON. The result can be read back with the kv.Valuer accessors.
+type Text struct{}
+
+func (Text) Marshal(value any) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return []byte{}, nil
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	case int:
+		return strconv.AppendInt(nil, int64(v), 10), nil
+	case int8:
+		return strconv.AppendInt(nil, int64(v), 10), nil
+	case int16:
+		return strconv.AppendInt(nil, int64(v), 10), nil
+	case int32:
+		return strconv.AppendInt(nil, int64(v), 10), nil
+	case int64:
+		return strconv.AppendInt(nil, v, 10), nil
+	case uint:
+		return strconv.AppendUint(nil, uint64(v), 10), nil
+	case uint8:
+		return strconv.AppendUint(nil, uint64(v), 10), nil
+	case uint16:
+		return strconv.AppendUint(nil, uint64(v), 10), nil
+	case uint32:
+		return strconv.AppendUint(nil, uint64(v), 10), nil
+	case uint64:
+		return strconv.AppendUint(nil, v, 10), nil
+	case float32:
+		return strconv.AppendFloat(nil, float64(v), 'f', -1, 32), nil
+	case float64:
+		return strconv.AppendFloat(nil, v, 'f', -1, 64), nil
+	case bool:
+		if v {
+			return []byte("1"), nil
+		}
+		return []byte("0"), nil
+	case time.Time:
+		return v.AppendFormat(nil, time.RFC3339Nano), nil
+	case time.Duration:
+		return strconv.AppendInt(nil, v.Nanoseconds(), 10), nil
+	case encoding.BinaryMarshaler:
+		return v.MarshalBinary()
+	}
+
+	// Named scalar types such as `type Status string` are encoded like their underlying kind.
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.String:
+		return []byte(rv.String()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.AppendInt(nil, rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.AppendUint(nil, rv.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.AppendFloat(nil, rv.Float(), 'f', -1, rv.Type().Bits()), nil
+	case reflect.Bool:
+		if rv.Bool() {
+			return []byte("1"), nil
+		}
+		return []byte("0"), nil
+	default:
+		return json.Marshal(value)
+	}
+}
+
+func (Text) Unmarshal(data []byte, dest any) error {
+	var err error
+
+	switch d := dest.(type) {
+	case *[]byte:
+		*d = append((*d)[:0], data...)
+	case *string:
+		*d = string(data)
+	case *int:
+		var n int64
+		n, err = strconv.ParseInt(string(data), 10, strconv.IntSize)
+		*d = int(n)
+	case *int8:
+		var n int64
+		n, err = strconv.ParseInt(string(data), 10, 8)
+		*d = int8(n)
+	case *int16:
+		var n int64
+		n, err = strconv.ParseInt(string(data), 10, 16)
+		*d = int16(n)
+	case *int32:
+		var n int64
+		n, err = strconv.ParseInt(string(data), 10, 32)
+		*d = int32(n)
+	case *int64:
+		*d, err = strconv.ParseInt(string(data), 10, 64)
+	case *uint:
+		var n uint64
+		n, err = strconv.ParseUint(string(data), 10, strconv.IntSize)
+		*d = uint(n)
+	case *uint8:
+		var n uint64
+		n, err = strconv.ParseUint(string(data), 10, 8)
+		*d = uint8(n)
+	case *uint16:
+		var n uint64
+		n, err = strconv.ParseUint(string(data), 10, 16)
+		*d = uint16(n)
+	case *uint32:
+		var n uint64
+		n, err = strconv.ParseUint(string(data), 10, 32)
+		*d = uint32(n)
+	case *uint64:
+		*d, err = strconv.ParseUint(string(data), 10, 64)
+	case *float32:
+		var f float64
+		f, err = strconv.ParseFloat(string(data), 32)
+		*d = float32(f)
+	case *float64:
+		*d, err = strconv.ParseFloat(string(data), 64)
+	case *bool:
+		*d, err = strconv.ParseBool(string(data))
+	case *time.Time:
+		*d, err = time.Parse(time.RFC3339Nano, string(data))
+	case *time.Duration:
+		var n int64
+		n, err = strconv.ParseInt(string(data), 10, 64)
+		*d = time.Duration(n)
+	case encoding.BinaryUnmarshaler:
+		err = d.UnmarshalBinary(data)
+	default:
+		rv := reflect.ValueOf(dest)
+		if rv.Kind() != reflect.Ptr || rv.IsNil() {
+			return json.Unmarshal(data, dest)
+		}
+
+		elem := rv.Elem()
+		switch elem.Kind() {
+		case reflect.Struct:
+			return kvscanner.Scan(data, dest)
+		case reflect.String:
+			elem.SetString(string(data))
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			var n int64
+			if n, err = strconv.ParseInt(string(data), 10, elem.Type().Bits()); err == nil {
+				elem.SetInt(n)
+			}
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			var n uint64
+			if n, err = strconv.ParseUint(string(data), 10, elem.Type().Bits()); err == nil {
+				elem.SetUint(n)
+			}
+		case reflect.Float32, reflect.Float64:
+			var f float64
+			if f, err = strconv.ParseFloat(string(data), elem.Type().Bits()); err == nil {
+				elem.SetFloat(f)
+			}
+		case reflect.Bool:
+			var b bool
+			if b, err = strconv.ParseBool(string(data)); err == nil {
+				elem.SetBool(b)
+			}
+		default:
+			return json.Unmarshal(data, dest)
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to decode %q into %T: %w", data, dest, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package kvcodec
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestText_Marshal(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		value any
+		want  string
+	}{
+		{name: "string", value: "value", want: "value"},
+		{name: "bytes", value: []byte("value"), want: "value"},
+		{name: "int", value: 5, want: "5"},
+		{name: "negative int64", value: int64(-42), want: "-42"},
+		{name: "uint8", value: uint8(255), want: "255"},
+		{name: "float64", value: 1.5, want: "1.5"},
+		{name: "float32", value: float32(0.1), want: "0.1"},
+		{name: "bool true", value: true, want: "1"},
+		{name: "bool false", value: false, want: "0"},
+		{name: "duration", value: 2 * time.Second, want: "2000000000"},
+		{name: "time", value: time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC), want: "2024-01-02T03:04:05.000000006Z"},
+		{name: "nil", value: nil, want: ""},
+		{name: "named int", value: time.Monday, want: "1"},
+		{name: "struct", value: struct {
+			Name string `json:"name"`
+		}{Name: "John"}, want: `{"name":"John"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := Text{}.Marshal(tt.value)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Marshal() got = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestText_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	type status string
+	type level uint8
+
+	type user struct {
+		Name string `kv:"name" json:"name"`
+		Age  int    `kv:"age" json:"age"`
+	}
+
+	tests := []struct {
+		name  string
+		value any
+		dest  any
+	}{
+		{name: "string", value: "value", dest: new(string)},
+		{name: "int", value: 5, dest: new(int)},
+		{name: "int64", value: int64(-42), dest: new(int64)},
+		{name: "uint32", value: uint32(7), dest: new(uint32)},
+		{name: "float64", value: 1.75, dest: new(float64)},
+		{name: "bool", value: true, dest: new(bool)},
+		{name: "duration", value: 1500 * time.Millisecond, dest: new(time.Duration)},
+		{name: "time", value: time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC), dest: new(time.Time)},
+		{name: "struct", value: user{Name: "John", Age: 30}, dest: new(user)},
+		{name: "slice", value: []string{"a", "b"}, dest: new([]string)},
+		{name: "named string", value: status("active"), dest: new(status)},
+		{name: "named uint8", value: level(3), dest: new(level)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			data, err := Text{}.Marshal(tt.value)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+
+			if err := (Text{}).Unmarshal(data, tt.dest); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+
+			got := reflect.ValueOf(tt.dest).Elem().Interface()
+			if !reflect.DeepEqual(got, tt.value) {
+				t.Errorf("Unmarshal() got = %v, want %v", got, tt.value)
+			}
+		})
+	}
+}
+
+func TestText_UnmarshalInvalid(t *testing.T) {
+	t.Parallel()
+
+	var n int
+	if err := (Text{}).Unmarshal([]byte("not a number"), &n); err == nil {
+		t.Errorf("Unmarshal() error = %v, wantErr %v", err, true)
+	}
+
+	var b int8
+	if err := (Text{}).Unmarshal([]byte("300"), &b); err == nil {
+		t.Errorf("Unmarshal() out of range error = %v, wantErr %v", err, true)
+	}
+}
@@ -10,3 +10,20 @@ var (
 )
 
 var ErrKeyNil = errors.New("key does not exist")
+
+// ErrNotSet is returned by Set when the value was not written because
+// a WithOnlyIfNotExists or WithOnlyIfExists condition was not met.
+var ErrNotSet = errors.New("value was not set")
+
+var ErrVersionMismatch = errors.New("version mismatch")
+
+// ErrNegativeCached is returned when a key is known to be absent, because a loader cached
+// the fact that the value does not exist. It differs from ErrKeyNil, which means the key
+// was never looked up or its cached state expired.
+var ErrNegativeCached = errors.New("key is cached as absent")
+
+var ErrNotSupported = errors.New("operation is not supported by this store")
+
+// ErrKeyCollision is returned when a key was transformed into the same stored key as another
+// key, so the stored value belongs to the other key.
+var ErrKeyCollision = errors.New("key collides with another key")
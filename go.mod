@@ -8,6 +8,10 @@ require (
 	github.com/bradfitz/gomemcache v0.0.0-20250403215159-8d39553ac7cf
 	github.com/maypok86/otter/v2 v2.2.1
 	github.com/redis/go-redis/v9 v9.14.0
+	github.com/testcontainers/testcontainers-go v0.39.0
+	github.com/testcontainers/testcontainers-go/modules/memcached v0.39.0
+	github.com/testcontainers/testcontainers-go/modules/redis v0.39.0
+	github.com/testcontainers/testcontainers-go/modules/valkey v0.39.0
 	github.com/valkey-io/valkey-glide/go/v2 v2.1.1
 	github.com/valkey-io/valkey-go v1.0.66
 )
@@ -56,10 +60,6 @@ require (
 	github.com/shirou/gopsutil/v4 v4.25.6 // indirect
 	github.com/sirupsen/logrus v1.9.3 // indirect
 	github.com/stretchr/testify v1.10.0 // indirect
-	github.com/testcontainers/testcontainers-go v0.39.0 // indirect
-	github.com/testcontainers/testcontainers-go/modules/memcached v0.39.0 // indirect
-	github.com/testcontainers/testcontainers-go/modules/redis v0.39.0 // indirect
-	github.com/testcontainers/testcontainers-go/modules/valkey v0.39.0 // indirect
 	github.com/tklauser/go-sysconf v0.3.14 // indirect
 	github.com/tklauser/numcpus v0.8.0 // indirect
 	github.com/yusufpapurcu/wmi v1.2.4 // indirect
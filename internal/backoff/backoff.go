@@ -0,0 +1,37 @@
+package backoff
+
+import (
+	"context"
+	"time"
+)
+
+// Backoff computes exponentially growing delays between retries.
+type Backoff struct {
+	Min     time.Duration
+	Max     time.Duration
+	current time.Duration
+}
+
+// Wait sleeps for the next delay. It reports false if ctx was cancelled while waiting.
+func (b *Backoff) Wait(ctx context.Context) bool {
+	if b.current == 0 {
+		b.current = b.Min
+	}
+
+	t := time.NewTimer(b.current)
+	defer t.Stop()
+
+	b.current = min(b.current*2, b.Max)
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// Reset makes the next delay start from Min again.
+func (b *Backoff) Reset() {
+	b.current = 0
+}
@@ -0,0 +1,33 @@
+package backoff
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBackoff_Wait(t *testing.T) {
+	t.Parallel()
+
+	b := Backoff{Min: time.Millisecond, Max: 4 * time.Millisecond}
+
+	for _, want := range []time.Duration{2, 4, 4} {
+		if !b.Wait(context.Background()) {
+			t.Fatalf("Wait() = %v, want %v", false, true)
+		}
+		if b.current != want*time.Millisecond {
+			t.Errorf("next delay = %v, want %v", b.current, want*time.Millisecond)
+		}
+	}
+
+	b.Reset()
+	if b.current != 0 {
+		t.Errorf("delay after Reset() = %v, want %v", b.current, 0)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if b.Wait(ctx) {
+		t.Errorf("Wait() with cancelled context = %v, want %v", true, false)
+	}
+}
@@ -0,0 +1,79 @@
+package envelope
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+)
+
+// magic prefixes every encoded envelope. It starts with a zero byte so it cannot be confused
+// with values written by the text codec.
+var magic = []byte{0x00, 'k', 'v', 'e', 1}
+
+const headerSize = 5 + 1 + 8 + 8 + 8
+
+// Envelope wraps a stored value with the metadata the loader needs to decide when to refresh it.
+type Envelope struct {
+	Value []byte
+	// Delta is how long it took to compute Value.
+	Delta time.Duration
+	// ExpiresAt is when the value expires, or the zero time if it never does.
+	ExpiresAt time.Time
+	// StaleUntil is when the value stops being served stale after ExpiresAt,
+	// or the zero time if it is never served stale.
+	StaleUntil time.Time
+	// Negative marks a cached miss: the value is known not to exist and Value is empty.
+	Negative bool
+}
+
+// Encode returns the binary representation of e.
+func (e Envelope) Encode() []byte {
+	b := make([]byte, 0, headerSize+len(e.Value))
+	b = append(b, magic...)
+	if e.Negative {
+		b = append(b, 1)
+	} else {
+		b = append(b, 0)
+	}
+	b = binary.BigEndian.AppendUint64(b, uint64(e.Delta))
+	b = binary.BigEndian.AppendUint64(b, uint64(unixNano(e.ExpiresAt)))
+	b = binary.BigEndian.AppendUint64(b, uint64(unixNano(e.StaleUntil)))
+
+	return append(b, e.Value...)
+}
+
+// Decode parses data produced by Encode. It reports false if data is not an envelope,
+// for example a value written to the store directly.
+func Decode(data []byte) (Envelope, bool) {
+	if len(data) < headerSize || !bytes.HasPrefix(data, magic) {
+		return Envelope{}, false
+	}
+
+	data = data[len(magic):]
+
+	e := Envelope{
+		Negative:   data[0] == 1,
+		Delta:      time.Duration(binary.BigEndian.Uint64(data[1:9])),
+		ExpiresAt:  fromUnixNano(int64(binary.BigEndian.Uint64(data[9:17]))),
+		StaleUntil: fromUnixNano(int64(binary.BigEndian.Uint64(data[17:25]))),
+		Value:      data[25:],
+	}
+
+	return e, true
+}
+
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return t.UnixNano()
+}
+
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, n)
+}
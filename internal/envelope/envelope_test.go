@@ -0,0 +1,65 @@
+package envelope
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestEnvelope_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		e    Envelope
+	}{
+		{
+			name: "full",
+			e: Envelope{
+				Value:      []byte("value"),
+				Delta:      150 * time.Millisecond,
+				ExpiresAt:  time.Unix(1700000000, 123),
+				StaleUntil: time.Unix(1700000060, 123),
+			},
+		},
+		{
+			name: "no expiry",
+			e:    Envelope{Value: []byte("value")},
+		},
+		{
+			name: "negative",
+			e:    Envelope{Value: []byte{}, Negative: true, ExpiresAt: time.Unix(1700000000, 0)},
+		},
+		{
+			name: "empty value",
+			e:    Envelope{Value: []byte{}, Delta: time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, ok := Decode(tt.e.Encode())
+			if !ok {
+				t.Fatalf("Decode() ok = %v, want %v", ok, true)
+			}
+
+			if !bytes.Equal(got.Value, tt.e.Value) || got.Delta != tt.e.Delta ||
+				!got.ExpiresAt.Equal(tt.e.ExpiresAt) || !got.StaleUntil.Equal(tt.e.StaleUntil) ||
+				got.Negative != tt.e.Negative {
+				t.Errorf("Decode() got = %+v, want %+v", got, tt.e)
+			}
+		})
+	}
+}
+
+func TestDecode_NotEnvelope(t *testing.T) {
+	t.Parallel()
+
+	for _, data := range [][]byte{nil, []byte("42"), []byte("a long plain value that is not an envelope")} {
+		if _, ok := Decode(data); ok {
+			t.Errorf("Decode(%q) ok = %v, want %v", data, ok, false)
+		}
+	}
+}
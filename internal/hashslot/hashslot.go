@@ -0,0 +1,61 @@
+package hashslot
+
+import (
+	"strings"
+)
+
+// SlotCount is the number of hash slots in a Redis or Valkey cluster.
+const SlotCount = 16384
+
+// Slot returns the cluster hash slot of key: CRC16 (XMODEM) of the key, or of its hash tag
+// when the key contains a non-empty "{...}" section, modulo SlotCount.
+func Slot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+
+	return int(crc16(key) % SlotCount)
+}
+
+// Group splits the indexes of keys into groups sharing a hash slot, so each group can be
+// sent as one multi-key command. Groups are ordered by the first appearance of their slot.
+func Group(keys []string) [][]int {
+	var (
+		groups [][]int
+		bySlot = make(map[int]int)
+	)
+
+	for i, key := range keys {
+		slot := Slot(key)
+
+		g, ok := bySlot[slot]
+		if !ok {
+			g = len(groups)
+			bySlot[slot] = g
+			groups = append(groups, nil)
+		}
+
+		groups[g] = append(groups[g], i)
+	}
+
+	return groups
+}
+
+func crc16(s string) uint16 {
+	var crc uint16
+
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for range 8 {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
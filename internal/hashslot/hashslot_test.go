@@ -0,0 +1,41 @@
+package hashslot
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSlot(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		key  string
+		want int
+	}{
+		{key: "123456789", want: 0x31C3},
+		{key: "foo", want: 12182},
+		{key: "bar", want: 5061},
+		{key: "", want: 0},
+		{key: "{user1000}.following", want: Slot("user1000")},
+		{key: "foo{}{bar}", want: Slot("foo{}{bar}")},
+		{key: "foo{{bar}}zap", want: Slot("{bar")},
+		{key: "foo{bar}{zap}", want: Slot("bar")},
+	}
+
+	for _, tt := range tests {
+		if got := Slot(tt.key); got != tt.want {
+			t.Errorf("Slot(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestGroup(t *testing.T) {
+	t.Parallel()
+
+	keys := []string{"{a}1", "foo", "{a}2", "bar", "foo"}
+	want := [][]int{{0, 2}, {1, 4}, {3}}
+
+	if got := Group(keys); !reflect.DeepEqual(got, want) {
+		t.Errorf("Group() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,54 @@
+package keyseal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/twirapp/kv"
+)
+
+// magic prefixes every sealed value. It starts with a zero byte so it cannot be confused
+// with values written by the text codec.
+var magic = []byte{0x00, 'k', 'v', 'k', 1}
+
+// Seal prefixes value with the key it was written for. Values stored under a transformed key
+// are sealed, so a reader can tell whether another key was transformed into the same one.
+func Seal(key string, value []byte) []byte {
+	b := make([]byte, 0, len(magic)+binary.MaxVarintLen64+len(key)+len(value))
+	b = append(b, magic...)
+	b = binary.AppendUvarint(b, uint64(len(key)))
+	b = append(b, key...)
+
+	return append(b, value...)
+}
+
+// Open parses data produced by Seal. It reports false if data is not sealed.
+func Open(data []byte) (key string, value []byte, ok bool) {
+	if !bytes.HasPrefix(data, magic) {
+		return "", nil, false
+	}
+
+	rest := data[len(magic):]
+	n, size := binary.Uvarint(rest)
+	if size <= 0 || uint64(len(rest)-size) < n {
+		return "", nil, false
+	}
+	rest = rest[size:]
+
+	return string(rest[:n]), rest[n:], true
+}
+
+// Check returns the value stored in data for key. It reports kv.ErrKeyCollision if data was
+// sealed for another key. Unsealed data, such as counters, is returned as is.
+func Check(key string, data []byte) ([]byte, error) {
+	owner, value, ok := Open(data)
+	if !ok {
+		return data, nil
+	}
+	if owner != key {
+		return nil, fmt.Errorf("key %q is stored under the same transformed key as %q: %w", key, owner, kv.ErrKeyCollision)
+	}
+
+	return value, nil
+}
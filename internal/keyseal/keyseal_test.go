@@ -0,0 +1,75 @@
+package keyseal
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/twirapp/kv"
+)
+
+func TestSeal_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		key   string
+		value []byte
+	}{
+		{name: "simple", key: "key", value: []byte("value")},
+		{name: "empty value", key: "key", value: []byte{}},
+		{name: "empty key", key: "", value: []byte("value")},
+		{name: "binary", key: "a b\x00c", value: []byte{0x00, 'k', 'v', 'k', 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			key, value, ok := Open(Seal(tt.key, tt.value))
+			if !ok {
+				t.Fatalf("Open() ok = false, want true")
+			}
+			if key != tt.key {
+				t.Errorf("Open() key = %q, want %q", key, tt.key)
+			}
+			if !bytes.Equal(value, tt.value) {
+				t.Errorf("Open() value = %q, want %q", value, tt.value)
+			}
+		})
+	}
+}
+
+func TestOpen_NotSealed(t *testing.T) {
+	t.Parallel()
+
+	sealed := Seal("key", []byte("value"))
+
+	for _, data := range [][]byte{
+		[]byte("plain value"),
+		[]byte("42"),
+		{},
+		sealed[:len(magic)],
+		sealed[:len(magic)+2],
+	} {
+		if _, _, ok := Open(data); ok {
+			t.Errorf("Open(%q) ok = true, want false", data)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	if got, err := Check("key", Seal("key", []byte("value"))); err != nil || string(got) != "value" {
+		t.Errorf("Check() own key got = %q, %v, want value", got, err)
+	}
+
+	if _, err := Check("key", Seal("other", []byte("value"))); !errors.Is(err, kv.ErrKeyCollision) {
+		t.Errorf("Check() other key error = %v, want %v", err, kv.ErrKeyCollision)
+	}
+
+	if got, err := Check("key", []byte("42")); err != nil || string(got) != "42" {
+		t.Errorf("Check() unsealed got = %q, %v, want 42", got, err)
+	}
+}
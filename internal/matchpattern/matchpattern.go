@@ -1,35 +1,119 @@
 package matchpattern
 
-func MatchPattern(patternParts, keyParts []string) bool {
-	if len(patternParts) == 1 && patternParts[0] == "*" {
-		return true
-	}
+// MatchPattern reports whether key matches the glob-style pattern using the same rules as
+// Redis KEYS and SCAN MATCH:
+//
+//   - '*' matches any sequence of bytes, including ':' separators
+//   - '?' matches exactly one byte
+//   - '[abc]', '[a-z]' and '[^abc]' match one byte from (or not from) a set
+//   - '\' escapes the next byte, both inside and outside of a set
+//
+// Matching is done byte by byte and is case-sensitive.
+func MatchPattern(pattern, key string) bool {
+	var (
+		p, k = 0, 0
+		// starP and starK remember the position after the last '*' and the key position it
+		// was matched against, so a failed match can backtrack by letting '*' consume one more byte.
+		starP, starK = -1, 0
+	)
 
-	if len(patternParts) > len(keyParts) {
-		return false
-	}
+	for k < len(key) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				for p < len(pattern) && pattern[p] == '*' {
+					p++
+				}
+				if p == len(pattern) {
+					return true
+				}
+				starP, starK = p, k
+				continue
+			case '?':
+				p++
+				k++
+				continue
+			case '[':
+				if matched, next := matchSet(pattern, p, key[k]); matched {
+					p = next
+					k++
+					continue
+				}
+			case '\\':
+				if p+1 < len(pattern) {
+					if pattern[p+1] == key[k] {
+						p += 2
+						k++
+						continue
+					}
+				} else if key[k] == '\\' {
+					p++
+					k++
+					continue
+				}
+			default:
+				if pattern[p] == key[k] {
+					p++
+					k++
+					continue
+				}
+			}
+		}
 
-	if len(patternParts) > 0 && patternParts[len(patternParts)-1] == "*" {
-		if len(patternParts)-1 > len(keyParts) {
+		if starP < 0 {
 			return false
 		}
-		for i := 0; i < len(patternParts)-1; i++ {
-			if patternParts[i] != "*" && patternParts[i] != keyParts[i] {
-				return false
-			}
-		}
-		return true
+
+		starK++
+		p, k = starP, starK
 	}
 
-	if len(patternParts) != len(keyParts) {
-		return false
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
 	}
 
-	for i := 0; i < len(patternParts); i++ {
-		if patternParts[i] != "*" && patternParts[i] != keyParts[i] {
-			return false
+	return p == len(pattern)
+}
+
+// matchSet matches c against the set starting at pattern[p] == '['. It returns whether c
+// is matched and the position right after the closing ']'. An unterminated set extends
+// to the end of the pattern, as in Redis.
+func matchSet(pattern string, p int, c byte) (bool, int) {
+	p++
+
+	negate := p < len(pattern) && pattern[p] == '^'
+	if negate {
+		p++
+	}
+
+	matched := false
+	for p < len(pattern) && pattern[p] != ']' {
+		switch {
+		case pattern[p] == '\\' && p+1 < len(pattern):
+			p++
+			if pattern[p] == c {
+				matched = true
+			}
+		case p+2 < len(pattern) && pattern[p+1] == '-':
+			start, end := pattern[p], pattern[p+2]
+			if start > end {
+				start, end = end, start
+			}
+			if c >= start && c <= end {
+				matched = true
+			}
+			p += 2
+		default:
+			if pattern[p] == c {
+				matched = true
+			}
 		}
+		p++
+	}
+
+	if p < len(pattern) {
+		p++
 	}
 
-	return true
+	return matched != negate, p
 }
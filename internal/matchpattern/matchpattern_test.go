@@ -0,0 +1,60 @@
+package matchpattern
+
+import (
+	"testing"
+)
+
+func TestMatchPattern(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		pattern string
+		key     string
+		want    bool
+	}{
+		{pattern: "*", key: "", want: true},
+		{pattern: "*", key: "user:1", want: true},
+		{pattern: "user:*", key: "user:1", want: true},
+		{pattern: "user:*", key: "user:profile:1", want: true},
+		{pattern: "user:*", key: "admin:1", want: false},
+		{pattern: "user:*:name", key: "user:1:name", want: true},
+		{pattern: "user:*:name", key: "user:1:2:name", want: true},
+		{pattern: "user:*:name", key: "user:1:email", want: false},
+		{pattern: "user:12*", key: "user:123", want: true},
+		{pattern: "user:12*", key: "user:13", want: false},
+		{pattern: "*:1", key: "user:1", want: true},
+		{pattern: "**a**", key: "bab", want: true},
+		{pattern: "user:?", key: "user:1", want: true},
+		{pattern: "user:?", key: "user:12", want: false},
+		{pattern: "user:?", key: "user:", want: false},
+		{pattern: "h?llo", key: "hello", want: true},
+		{pattern: "h[ae]llo", key: "hello", want: true},
+		{pattern: "h[ae]llo", key: "hallo", want: true},
+		{pattern: "h[ae]llo", key: "hillo", want: false},
+		{pattern: "h[^e]llo", key: "hallo", want: true},
+		{pattern: "h[^e]llo", key: "hello", want: false},
+		{pattern: "h[a-b]llo", key: "hbllo", want: true},
+		{pattern: "h[a-b]llo", key: "hcllo", want: false},
+		{pattern: "h[b-a]llo", key: "hallo", want: true},
+		{pattern: "[\\]]", key: "]", want: true},
+		{pattern: "[abc", key: "a", want: true},
+		{pattern: "user\\*", key: "user*", want: true},
+		{pattern: "user\\*", key: "user1", want: false},
+		{pattern: "user\\?", key: "user?", want: true},
+		{pattern: "a\\", key: "a\\", want: true},
+		{pattern: "*[0-9]", key: "user:1", want: true},
+		{pattern: "*[0-9]", key: "user:a", want: false},
+		{pattern: "a*b*c", key: "axxbyyc", want: true},
+		{pattern: "a*b*c", key: "axxbyy", want: false},
+		{pattern: "user:1", key: "user:1", want: true},
+		{pattern: "user:1", key: "user:10", want: false},
+		{pattern: "", key: "", want: true},
+		{pattern: "", key: "a", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := MatchPattern(tt.pattern, tt.key); got != tt.want {
+			t.Errorf("MatchPattern(%q, %q) = %v, want %v", tt.pattern, tt.key, got, tt.want)
+		}
+	}
+}
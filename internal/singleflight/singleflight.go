@@ -0,0 +1,76 @@
+package singleflight
+
+import (
+	"sync"
+)
+
+// Result holds the outcome of a call made through a Group.
+type Result[T any] struct {
+	Val T
+	Err error
+	// Shared reports whether the result was delivered to more than one caller.
+	Shared bool
+}
+
+type call[T any] struct {
+	done chan struct{}
+	val  T
+	err  error
+	dups int
+}
+
+// Group deduplicates concurrent calls that share a key, so fn runs once per key at a time.
+// The zero value is ready to use.
+type Group[T any] struct {
+	mu    sync.Mutex
+	calls map[string]*call[T]
+}
+
+// Do runs fn for key unless a call for the same key is already in flight, in which case it
+// waits for that call and returns its result.
+func (g *Group[T]) Do(key string, fn func() (T, error)) Result[T] {
+	return <-g.DoChan(key, fn)
+}
+
+// DoChan is like Do but returns a channel that receives the result once it is ready.
+// The channel is buffered, so callers that stop waiting do not block fn.
+func (g *Group[T]) DoChan(key string, fn func() (T, error)) <-chan Result[T] {
+	ch := make(chan Result[T], 1)
+
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call[T])
+	}
+
+	if c, ok := g.calls[key]; ok {
+		c.dups++
+		g.mu.Unlock()
+
+		go func() {
+			<-c.done
+			ch <- Result[T]{Val: c.val, Err: c.err, Shared: true}
+		}()
+
+		return ch
+	}
+
+	c := &call[T]{done: make(chan struct{})}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	go func() {
+		defer func() {
+			g.mu.Lock()
+			delete(g.calls, key)
+			shared := c.dups > 0
+			g.mu.Unlock()
+
+			close(c.done)
+			ch <- Result[T]{Val: c.val, Err: c.err, Shared: shared}
+		}()
+
+		c.val, c.err = fn()
+	}()
+
+	return ch
+}
@@ -0,0 +1,63 @@
+package singleflight
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGroup_Do(t *testing.T) {
+	t.Parallel()
+
+	var (
+		g     Group[string]
+		calls atomic.Int32
+		wg    sync.WaitGroup
+	)
+
+	release := make(chan struct{})
+	results := make([]Result[string], 10)
+
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = g.Do("key", func() (string, error) {
+				calls.Add(1)
+				<-release
+				return "value", nil
+			})
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Do() ran fn %d times, want 1", n)
+	}
+
+	for i, r := range results {
+		if r.Err != nil || r.Val != "value" || !r.Shared {
+			t.Errorf("Do() result %d got = %+v, want shared value", i, r)
+		}
+	}
+}
+
+func TestGroup_DoSequential(t *testing.T) {
+	t.Parallel()
+
+	var g Group[int]
+	errFailed := errors.New("failed")
+
+	if r := g.Do("key", func() (int, error) { return 0, errFailed }); !errors.Is(r.Err, errFailed) || r.Shared {
+		t.Errorf("Do() got = %+v, want unshared error %v", r, errFailed)
+	}
+
+	if r := g.Do("key", func() (int, error) { return 2, nil }); r.Err != nil || r.Val != 2 {
+		t.Errorf("Do() after a finished call got = %+v, want 2", r)
+	}
+}
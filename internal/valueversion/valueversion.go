@@ -0,0 +1,73 @@
+// Package valueversion provides the version tokens of the stores: revisions for stores that
+// keep one per key, such as the in-memory stores, and tokens derived from stored values for
+// stores that do not, such as Redis and Valkey.
+package valueversion
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// revisions is the source of Next.
+var revisions atomic.Uint64
+
+// Next returns a new write revision. Revisions are shared by all stores, so a key that is
+// deleted and written again never reuses a version.
+func Next() uint64 {
+	return revisions.Add(1)
+}
+
+// CompareAndSwapScript replaces KEYS[1] with ARGV[2] only if the SHA1 of its current value equals ARGV[1].
+// ARGV[3] is an optional expiration in milliseconds. It returns 1 on success and 0 on a version mismatch.
+const CompareAndSwapScript = `
+local current = redis.call('GET', KEYS[1])
+if not current or redis.sha1hex(current) ~= ARGV[1] then
+	return 0
+end
+if tonumber(ARGV[3]) > 0 then
+	redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+else
+	redis.call('SET', KEYS[1], ARGV[2])
+end
+return 1
+`
+
+// Of returns the version of value, matching redis.sha1hex in CompareAndSwapScript.
+func Of(value []byte) string {
+	sum := sha1.Sum(value)
+	return hex.EncodeToString(sum[:])
+}
+
+// ExpireArg formats d as the ARGV[3] expiration of CompareAndSwapScript. Positive durations are
+// rounded up to whole milliseconds, as a zero expiration means the value never expires.
+func ExpireArg(d time.Duration) string {
+	if d <= 0 {
+		return "0"
+	}
+
+	return strconv.FormatInt(Milliseconds(d), 10)
+}
+
+// Milliseconds returns d in milliseconds for PX and PEXPIRE. Positive durations are rounded up,
+// so a sub-millisecond expiration does not become 0, which deletes the key or never expires it.
+func Milliseconds(d time.Duration) int64 {
+	if d <= 0 {
+		return d.Milliseconds()
+	}
+
+	return int64((d + time.Millisecond - 1) / time.Millisecond)
+}
+
+// UnixMilli returns t as a Unix timestamp in milliseconds for PEXPIREAT, rounded up so a
+// deadline just ahead of now is not sent as one already in the past.
+func UnixMilli(t time.Time) int64 {
+	ms := t.UnixMilli()
+	if t.Nanosecond()%int(time.Millisecond) > 0 {
+		ms++
+	}
+
+	return ms
+}
@@ -0,0 +1,66 @@
+package valueversion
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpireArg(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		d    time.Duration
+		want string
+	}{
+		{name: "no expiration", d: 0, want: "0"},
+		{name: "negative", d: -time.Second, want: "0"},
+		{name: "sub-millisecond", d: time.Nanosecond, want: "1"},
+		{name: "one millisecond", d: time.Millisecond, want: "1"},
+		{name: "just over a millisecond", d: time.Millisecond + time.Microsecond, want: "2"},
+		{name: "one second", d: time.Second, want: "1000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := ExpireArg(tt.d); got != tt.want {
+				t.Errorf("ExpireArg(%v) = %q, want %q", tt.d, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMilliseconds(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		d    time.Duration
+		want int64
+	}{
+		{d: -time.Second, want: -1000},
+		{d: 0, want: 0},
+		{d: 500 * time.Microsecond, want: 1},
+		{d: time.Millisecond, want: 1},
+		{d: time.Millisecond + time.Nanosecond, want: 2},
+		{d: time.Minute, want: 60000},
+	}
+
+	for _, tt := range tests {
+		if got := Milliseconds(tt.d); got != tt.want {
+			t.Errorf("Milliseconds(%v) = %d, want %d", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestUnixMilli(t *testing.T) {
+	t.Parallel()
+
+	if got := UnixMilli(time.UnixMilli(1700000000000)); got != 1700000000000 {
+		t.Errorf("UnixMilli() whole millisecond = %d, want %d", got, int64(1700000000000))
+	}
+	if got := UnixMilli(time.UnixMilli(1700000000000).Add(time.Microsecond)); got != 1700000000001 {
+		t.Errorf("UnixMilli() fractional millisecond = %d, want %d", got, int64(1700000000001))
+	}
+}
@@ -2,13 +2,23 @@ package kv
 
 import (
 	"context"
+	"iter"
+	"time"
 
 	kvoptions "github.com/twirapp/kv/options"
 )
 
 type KV interface {
 	Get(ctx context.Context, key string) Valuer
+	// GetMany returns a slice of Valuers for the given keys.
+	// The order of the Valuers corresponds to the order of the keys provided.
+	// Missing keys are returned as Valuers whose Err() is ErrKeyNil.
+	GetMany(ctx context.Context, keys []string) []Valuer
+	// Set stores value under key. If a WithOnlyIfNotExists or WithOnlyIfExists condition
+	// prevents the write, Set returns ErrNotSet.
 	Set(ctx context.Context, key string, value any, options ...kvoptions.Option) error
+	// SetMany stores every value with its own options. Values whose WithOnlyIfNotExists or
+	// WithOnlyIfExists condition is not met are skipped, and the returned error matches ErrNotSet.
 	SetMany(ctx context.Context, values []SetMany) error
 	Delete(ctx context.Context, key string) error
 	DeleteMany(ctx context.Context, keys []string) error
@@ -17,8 +27,62 @@ type KV interface {
 	// The order of the bools corresponds to the order of the keys provided.
 	ExistsMany(ctx context.Context, keys []string) ([]bool, error)
 	GetKeysByPattern(ctx context.Context, pattern string) ([]string, error)
+	// ScanKeys returns an iterator over the keys matching pattern. Keys are fetched page by page,
+	// so the full key set is never held in memory. Iteration stops when the caller breaks out of
+	// the loop or ctx is cancelled; errors are yielded as the last element.
+	// Like SCAN, a key may be yielded more than once if the keyspace changes during iteration.
+	ScanKeys(ctx context.Context, pattern string) iter.Seq2[string, error]
+	// DeleteByPattern deletes every key matching pattern and returns the number of deleted keys.
+	DeleteByPattern(ctx context.Context, pattern string) (int64, error)
+	// Incr atomically increments the integer stored at key by one and returns the new value.
+	// A missing key is treated as 0. The WithExpire option is applied only when the key is created.
+	Incr(ctx context.Context, key string, options ...kvoptions.Option) (int64, error)
+	// IncrBy atomically increments the integer stored at key by delta and returns the new value.
+	// A missing key is treated as 0. The WithExpire option is applied only when the key is created.
+	IncrBy(ctx context.Context, key string, delta int64, options ...kvoptions.Option) (int64, error)
+	// IncrByFloat atomically increments the float stored at key by delta and returns the new value.
+	// A missing key is treated as 0. The WithExpire option is applied only when the key is created.
+	IncrByFloat(ctx context.Context, key string, delta float64, options ...kvoptions.Option) (float64, error)
+	// Decr atomically decrements the integer stored at key by one and returns the new value.
+	// A missing key is treated as 0. The WithExpire option is applied only when the key is created.
+	Decr(ctx context.Context, key string, options ...kvoptions.Option) (int64, error)
+	// TTL returns the remaining time to live of key, or NoExpiration if the key never expires.
+	// It returns ErrKeyNil if the key does not exist.
+	TTL(ctx context.Context, key string) (time.Duration, error)
+	// Expire sets the time to live of an existing key. A non-positive duration deletes the key.
+	// It returns ErrKeyNil if the key does not exist.
+	Expire(ctx context.Context, key string, d time.Duration) error
+	// ExpireAt sets the absolute expiration time of an existing key. A time in the past deletes the key.
+	// It returns ErrKeyNil if the key does not exist.
+	ExpireAt(ctx context.Context, key string, t time.Time) error
+	// Persist removes the expiration of an existing key.
+	// It returns ErrKeyNil if the key does not exist.
+	Persist(ctx context.Context, key string) error
+	// GetWithVersion returns the value stored under key together with an opaque version token
+	// that can be passed to CompareAndSwap. Errors are reported through the Valuer.
+	GetWithVersion(ctx context.Context, key string) (Valuer, Version)
+	// CompareAndSwap stores value under key only if the key still has the given version.
+	// It returns ErrVersionMismatch if the key was modified or deleted since the version was read.
+	CompareAndSwap(ctx context.Context, key string, version Version, value any, options ...kvoptions.Option) error
 }
 
+// TTLManyProvider is implemented by stores that can look up the remaining time to live of
+// several keys in one round-trip.
+type TTLManyProvider interface {
+	// TTLMany returns the remaining time to live of each key, or NoExpiration for keys without
+	// an expiration. The order of the durations corresponds to the order of the keys provided;
+	// missing keys are reported as 0.
+	TTLMany(ctx context.Context, keys []string) ([]time.Duration, error)
+}
+
+// Version is an opaque token identifying a revision of a key, as returned by GetWithVersion.
+// Redis and Valkey stores derive it from the value itself, so writing back an identical value
+// does not invalidate it.
+type Version string
+
+// NoExpiration is returned by TTL for keys without an associated expiration.
+const NoExpiration time.Duration = -1
+
 type Valuer interface {
 	Int() (int64, error)
 	String() (string, error)
@@ -29,6 +93,21 @@ type Valuer interface {
 	Err() error
 }
 
+// StaleValuer is implemented by Valuers that can be served past their soft expiry.
+// Only values read through a kvloader.Loader with stale-while-revalidate enabled can be stale.
+type StaleValuer interface {
+	Valuer
+	// IsStale reports whether the value is past its soft expiry and is served while it is
+	// being refreshed.
+	IsStale() bool
+}
+
+// IsStale reports whether v is a StaleValuer holding a stale value.
+func IsStale(v Valuer) bool {
+	sv, ok := v.(StaleValuer)
+	return ok && sv.IsStale()
+}
+
 type SetMany struct {
 	Key     string
 	Value   any
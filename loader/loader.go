@@ -0,0 +1,366 @@
+package kvloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"github.com/twirapp/kv"
+	kvcodec "github.com/twirapp/kv/codec"
+	"github.com/twirapp/kv/internal/envelope"
+	"github.com/twirapp/kv/internal/singleflight"
+	kvoptions "github.com/twirapp/kv/options"
+	kvvaluer "github.com/twirapp/kv/valuer"
+)
+
+// refreshLockSuffix is appended to a key to build the key of its refresh lock.
+const refreshLockSuffix = ":refresh-lock"
+
+// DefaultRefreshBackoff is the default time readers wait after a failed refresh of a key
+// before refreshing it again.
+const DefaultRefreshBackoff = 5 * time.Second
+
+// LoadFunc loads the value of a key missing from the store, for example from a database.
+type LoadFunc func(ctx context.Context) (any, error)
+
+type Option func(*Loader)
+
+// WithCodec sets the codec used to encode loaded values. Defaults to the codec of the store.
+func WithCodec(codec kvcodec.Codec) Option {
+	return func(l *Loader) {
+		l.codec = codec
+	}
+}
+
+// WithEarlyExpiration enables probabilistic early expiration (XFetch) for keys loaded with
+// an expiry. Values are stored in an envelope together with the time it took to load them,
+// and each read refreshes the value ahead of its expiry with a probability that grows as the
+// expiry approaches and with the load time. A beta of 1 is a good default, larger values
+// refresh earlier.
+//
+// Only the reader that wins a short-lived lock key in the store refreshes the value, so
+// processes sharing a store do not recompute it at the same time. If the refresh fails, the
+// current value is returned, the error goes to the refresh error handler and the lock is kept
+// for the refresh backoff, after which a later read retries. Keys written through a loader with
+// early expiration must be read through it as well.
+func WithEarlyExpiration(beta float64) Option {
+	return func(l *Loader) {
+		l.beta = beta
+	}
+}
+
+// WithStaleWhileRevalidate keeps values loaded with an expiry for staleFor after they expire.
+// A value read during that window is reported stale by kv.IsStale while a single background
+// refresh replaces it. If the refresh fails, the stale value keeps being served and the refresh
+// is retried after the refresh backoff, until the window closes and the key is loaded again on
+// the next read.
+//
+// Keys written through a loader with stale-while-revalidate must be read through it as well.
+func WithStaleWhileRevalidate(staleFor time.Duration) Option {
+	return func(l *Loader) {
+		l.staleFor = staleFor
+	}
+}
+
+// WithRefreshErrorHandler sets a function called when a background or early refresh fails.
+// The current value stays in place in that case, so the error is otherwise not reported.
+func WithRefreshErrorHandler(fn func(key string, err error)) Option {
+	return func(l *Loader) {
+		l.onRefreshError = fn
+	}
+}
+
+// WithRefreshBackoff sets how long readers wait after a failed background or early refresh of
+// a key before refreshing it again. The refresh lock is kept for d after the failure, so a
+// failing origin is called at most once per d for each key instead of on every read.
+// A non-positive d retries on the next read. Defaults to DefaultRefreshBackoff.
+func WithRefreshBackoff(d time.Duration) Option {
+	return func(l *Loader) {
+		l.refreshBackoff = d
+	}
+}
+
+// WithNegativeCaching caches misses for ttl. When load returns an error wrapping kv.ErrKeyNil,
+// the loader stores a negative entry instead of calling load again on every read, and reports
+// kv.ErrNegativeCached until the entry expires.
+//
+// Keys written through a loader with negative caching must be read through it as well.
+func WithNegativeCaching(ttl time.Duration) Option {
+	return func(l *Loader) {
+		l.negativeTTL = ttl
+	}
+}
+
+// Loader reads keys through a store, loading and storing missing values on demand.
+// Concurrent loads of the same key within the process are deduplicated, so a cold key
+// results in a single call to the loader no matter how many goroutines ask for it.
+type Loader struct {
+	store kv.KV
+	codec kvcodec.Codec
+	group singleflight.Group[[]byte]
+	now   func() time.Time
+
+	beta           float64
+	staleFor       time.Duration
+	negativeTTL    time.Duration
+	refreshBackoff time.Duration
+	onRefreshError func(key string, err error)
+}
+
+func New(store kv.KV, options ...Option) *Loader {
+	l := &Loader{
+		store:          store,
+		codec:          kv.CodecOf(store),
+		now:            time.Now,
+		refreshBackoff: DefaultRefreshBackoff,
+	}
+
+	for _, o := range options {
+		o(l)
+	}
+
+	return l
+}
+
+// Get returns the value stored under key without loading it. It returns kv.ErrNegativeCached
+// if the key is cached as absent and kv.ErrKeyNil if the key was never loaded.
+func (l *Loader) Get(ctx context.Context, key string) kv.Valuer {
+	v := l.store.Get(ctx, key)
+	if v.Err() != nil {
+		return v
+	}
+
+	data, _ := v.Bytes()
+	e, ok := envelope.Decode(data)
+	if !ok {
+		return v
+	}
+
+	if e.Negative {
+		return &kvvaluer.Valuer{Error: kv.ErrNegativeCached}
+	}
+
+	return &kvvaluer.Valuer{Value: e.Value, Stale: l.isStale(e)}
+}
+
+// SetNegative caches key as absent for the negative caching TTL, so reads through the loader
+// report kv.ErrNegativeCached without calling the loader. It returns kv.ErrNotSupported if
+// negative caching is not enabled.
+func (l *Loader) SetNegative(ctx context.Context, key string) error {
+	if l.negativeTTL <= 0 {
+		return fmt.Errorf("negative caching is not enabled: %w", kv.ErrNotSupported)
+	}
+
+	return l.setNegative(ctx, key)
+}
+
+// GetOrLoad returns the value stored under key. If the key does not exist, it calls load,
+// stores the result with the given options and returns it. Errors from load or from storing
+// the value are reported through the Valuer.
+//
+// The loader runs detached from the cancellation of ctx, so a caller giving up does not fail
+// the load for other callers waiting on the same key.
+func (l *Loader) GetOrLoad(ctx context.Context, key string, load LoadFunc, options ...kvoptions.Option) kv.Valuer {
+	v := l.store.Get(ctx, key)
+	if err := v.Err(); err != nil {
+		if errors.Is(err, kv.ErrKeyNil) {
+			return l.wait(ctx, key, load, options)
+		}
+		return v
+	}
+
+	if !l.enveloped() {
+		return v
+	}
+
+	data, _ := v.Bytes()
+	e, ok := envelope.Decode(data)
+	if !ok {
+		return v
+	}
+
+	switch {
+	case e.Negative:
+		return &kvvaluer.Valuer{Error: kv.ErrNegativeCached}
+	case l.isStale(e):
+		l.revalidate(ctx, key, e, load, options)
+		return &kvvaluer.Valuer{Value: e.Value, Stale: true}
+	case l.shouldRefreshEarly(e) && l.lockRefresh(ctx, key, e.ExpiresAt):
+		return l.refreshEarly(ctx, key, e, load, options)
+	}
+
+	return &kvvaluer.Valuer{Value: e.Value}
+}
+
+func (l *Loader) enveloped() bool {
+	return l.beta > 0 || l.staleFor > 0 || l.negativeTTL > 0
+}
+
+func (l *Loader) isStale(e envelope.Envelope) bool {
+	return l.staleFor > 0 && !e.ExpiresAt.IsZero() && !l.now().Before(e.ExpiresAt)
+}
+
+// revalidate refreshes a stale key in the background, unless another reader is already
+// refreshing it.
+func (l *Loader) revalidate(ctx context.Context, key string, e envelope.Envelope, load LoadFunc, options []kvoptions.Option) {
+	if !l.lockRefresh(ctx, key, e.StaleUntil) {
+		return
+	}
+
+	l.refresh(ctx, key, load, options)
+}
+
+// refreshEarly refreshes a key ahead of its expiry and returns the new value. The current
+// value is still valid, so it is returned instead if the refresh fails or ctx is done.
+func (l *Loader) refreshEarly(ctx context.Context, key string, e envelope.Envelope, load LoadFunc, options []kvoptions.Option) kv.Valuer {
+	select {
+	case <-ctx.Done():
+		return &kvvaluer.Valuer{Value: e.Value}
+	case res := <-l.refresh(ctx, key, load, options):
+		if res.Err != nil {
+			return &kvvaluer.Valuer{Value: e.Value}
+		}
+		return &kvvaluer.Valuer{Value: res.Val}
+	}
+}
+
+// refresh loads key in the background, detached from the cancellation of ctx, while the
+// current value is still served. The refresh lock is released once the refresh succeeds.
+// Failures are reported to the refresh error handler and keep the lock for the refresh
+// backoff, so the next reader retries only after it.
+func (l *Loader) refresh(ctx context.Context, key string, load LoadFunc, options []kvoptions.Option) <-chan singleflight.Result[[]byte] {
+	ctx = context.WithoutCancel(ctx)
+
+	return l.group.DoChan(key, func() ([]byte, error) {
+		data, err := l.load(ctx, key, load, options)
+		if err != nil {
+			if l.onRefreshError != nil {
+				l.onRefreshError(key, err)
+			}
+			l.backOffRefresh(ctx, key)
+
+			return nil, err
+		}
+
+		_ = l.store.Delete(ctx, key+refreshLockSuffix)
+
+		return data, nil
+	})
+}
+
+// backOffRefresh holds the refresh lock of key for the refresh backoff after a failed refresh.
+// The lock is set rather than extended, as it may have expired while the refresh was running.
+func (l *Loader) backOffRefresh(ctx context.Context, key string) {
+	if l.refreshBackoff <= 0 {
+		_ = l.store.Delete(ctx, key+refreshLockSuffix)
+		return
+	}
+
+	_ = l.store.Set(ctx, key+refreshLockSuffix, "1", kvoptions.WithExpire(l.refreshBackoff))
+}
+
+// shouldRefreshEarly implements the XFetch condition: now - delta * beta * ln(rand) >= expiry.
+func (l *Loader) shouldRefreshEarly(e envelope.Envelope) bool {
+	if l.beta <= 0 || e.ExpiresAt.IsZero() {
+		return false
+	}
+
+	// 1 - Float64() is in (0, 1], so the logarithm is finite and non-positive.
+	gap := -float64(e.Delta) * l.beta * math.Log(1-rand.Float64())
+
+	return !l.now().Add(time.Duration(gap)).Before(e.ExpiresAt)
+}
+
+// lockRefresh reports whether this reader won the right to refresh key ahead of its removal
+// from the store. The lock lives at most until the given time, after which every reader
+// sees a miss anyway.
+func (l *Loader) lockRefresh(ctx context.Context, key string, until time.Time) bool {
+	ttl := until.Sub(l.now())
+	if ttl <= 0 {
+		return true
+	}
+
+	err := l.store.Set(
+		ctx,
+		key+refreshLockSuffix,
+		"1",
+		kvoptions.WithExpire(ttl),
+		kvoptions.WithOnlyIfNotExists(),
+	)
+
+	return err == nil
+}
+
+func (l *Loader) wait(ctx context.Context, key string, load LoadFunc, options []kvoptions.Option) kv.Valuer {
+	ch := l.group.DoChan(key, func() ([]byte, error) {
+		return l.load(context.WithoutCancel(ctx), key, load, options)
+	})
+
+	select {
+	case <-ctx.Done():
+		return &kvvaluer.Valuer{Error: ctx.Err()}
+	case res := <-ch:
+		return &kvvaluer.Valuer{Value: res.Val, Error: res.Err}
+	}
+}
+
+func (l *Loader) load(ctx context.Context, key string, load LoadFunc, options []kvoptions.Option) ([]byte, error) {
+	start := l.now()
+
+	value, err := load(ctx)
+	if err != nil {
+		if l.negativeTTL > 0 && errors.Is(err, kv.ErrKeyNil) {
+			if err := l.setNegative(ctx, key); err != nil {
+				return nil, err
+			}
+			return nil, kv.ErrNegativeCached
+		}
+		return nil, err
+	}
+
+	data, err := l.codec.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := data
+	if l.enveloped() {
+		now := l.now()
+		e := envelope.Envelope{
+			Value: data,
+			Delta: now.Sub(start),
+		}
+		if o := kvoptions.Construct(options...); o.Expire > 0 {
+			e.ExpiresAt = now.Add(o.Expire)
+			if l.staleFor > 0 {
+				e.StaleUntil = e.ExpiresAt.Add(l.staleFor)
+				options = append(slices.Clip(options), kvoptions.WithExpire(o.Expire+l.staleFor))
+			}
+		}
+		stored = e.Encode()
+	}
+
+	if err := l.store.Set(ctx, key, stored, options...); err != nil {
+		return nil, fmt.Errorf("failed to store loaded value: %w", err)
+	}
+
+	return data, nil
+}
+
+func (l *Loader) setNegative(ctx context.Context, key string) error {
+	e := envelope.Envelope{
+		Value:     []byte{},
+		Negative:  true,
+		ExpiresAt: l.now().Add(l.negativeTTL),
+	}
+
+	if err := l.store.Set(ctx, key, e.Encode(), kvoptions.WithExpire(l.negativeTTL)); err != nil {
+		return fmt.Errorf("failed to store negative entry: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,421 @@
+package kvloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/twirapp/kv"
+	kvoptions "github.com/twirapp/kv/options"
+	kvinmemory "github.com/twirapp/kv/stores/inmemory"
+)
+
+func TestLoader_GetOrLoad(t *testing.T) {
+	t.Parallel()
+
+	store := kvinmemory.New()
+	l := New(store)
+	ctx := context.Background()
+
+	var (
+		calls atomic.Int32
+		wg    sync.WaitGroup
+	)
+
+	load := func(ctx context.Context) (any, error) {
+		calls.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		return 42, nil
+	}
+
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			got, err := l.GetOrLoad(ctx, "key", load, kvoptions.WithExpire(time.Minute)).Int()
+			if err != nil || got != 42 {
+				t.Errorf("GetOrLoad() got = %v, %v, want 42", got, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("GetOrLoad() called loader %d times, want 1", n)
+	}
+
+	if got, err := store.Get(ctx, "key").Int(); err != nil || got != 42 {
+		t.Errorf("Get() after GetOrLoad() got = %v, %v, want 42", got, err)
+	}
+
+	if ttl, err := store.TTL(ctx, "key"); err != nil || ttl <= 0 || ttl > time.Minute {
+		t.Errorf("TTL() after GetOrLoad() got = %v, %v, want up to %v", ttl, err, time.Minute)
+	}
+
+	if got, err := l.GetOrLoad(ctx, "key", load).Int(); err != nil || got != 42 || calls.Load() != 1 {
+		t.Errorf("GetOrLoad() on cached key got = %v, %v, loader calls = %d", got, err, calls.Load())
+	}
+}
+
+func TestLoader_GetOrLoadError(t *testing.T) {
+	t.Parallel()
+
+	store := kvinmemory.New()
+	l := New(store)
+	ctx := context.Background()
+
+	errLoad := errors.New("database is down")
+	v := l.GetOrLoad(ctx, "key", func(ctx context.Context) (any, error) {
+		return nil, errLoad
+	})
+	if !errors.Is(v.Err(), errLoad) {
+		t.Errorf("GetOrLoad() error = %v, want %v", v.Err(), errLoad)
+	}
+
+	if err := store.Get(ctx, "key").Err(); !errors.Is(err, kv.ErrKeyNil) {
+		t.Errorf("Get() after failed load error = %v, want %v", err, kv.ErrKeyNil)
+	}
+}
+
+func TestLoader_GetOrLoadCanceled(t *testing.T) {
+	t.Parallel()
+
+	store := kvinmemory.New()
+	l := New(store)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	release := make(chan struct{})
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+
+	v := l.GetOrLoad(ctx, "key", func(ctx context.Context) (any, error) {
+		<-release
+		return "value", ctx.Err()
+	})
+	if !errors.Is(v.Err(), context.Canceled) {
+		t.Errorf("GetOrLoad() error = %v, want %v", v.Err(), context.Canceled)
+	}
+
+	close(release)
+
+	// The load keeps running for other callers and still stores its result.
+	time.Sleep(20 * time.Millisecond)
+	if got, err := store.Get(context.Background(), "key").String(); err != nil || got != "value" {
+		t.Errorf("Get() after canceled GetOrLoad() got = %v, %v, want value", got, err)
+	}
+}
+
+func TestLoader_EarlyExpiration(t *testing.T) {
+	t.Parallel()
+
+	store := kvinmemory.New()
+	ctx := context.Background()
+
+	now := time.Now()
+	l := New(store, WithEarlyExpiration(1))
+	l.now = func() time.Time { return now }
+
+	var calls atomic.Int32
+	load := func(ctx context.Context) (any, error) {
+		// Pretend the load takes a second.
+		now = now.Add(time.Second)
+		return calls.Add(1), nil
+	}
+
+	if got, err := l.GetOrLoad(ctx, "key", load, kvoptions.WithExpire(time.Minute)).Int(); err != nil || got != 1 {
+		t.Fatalf("GetOrLoad() got = %v, %v, want 1", got, err)
+	}
+
+	// Far from the expiry the value is served from the store.
+	if got, err := l.GetOrLoad(ctx, "key", load, kvoptions.WithExpire(time.Minute)).Int(); err != nil || got != 1 {
+		t.Errorf("GetOrLoad() before expiry got = %v, %v, want 1", got, err)
+	}
+
+	// Another process already holds the refresh lock, so the current value is served.
+	if err := store.Set(ctx, "key"+refreshLockSuffix, "1"); err != nil {
+		t.Fatalf("Set() lock error = %v", err)
+	}
+	now = now.Add(time.Minute - time.Microsecond)
+	if got, err := l.GetOrLoad(ctx, "key", load, kvoptions.WithExpire(time.Minute)).Int(); err != nil || got != 1 {
+		t.Errorf("GetOrLoad() with a held lock got = %v, %v, want 1", got, err)
+	}
+
+	// Right before the expiry, with a load time far larger than the time left, the value is refreshed.
+	if err := store.Delete(ctx, "key"+refreshLockSuffix); err != nil {
+		t.Fatalf("Delete() lock error = %v", err)
+	}
+	if got, err := l.GetOrLoad(ctx, "key", load, kvoptions.WithExpire(time.Minute)).Int(); err != nil || got != 2 {
+		t.Errorf("GetOrLoad() near expiry got = %v, %v, want 2", got, err)
+	}
+
+	if got, err := l.GetOrLoad(ctx, "key", load, kvoptions.WithExpire(time.Minute)).Int(); err != nil || got != 2 {
+		t.Errorf("GetOrLoad() after refresh got = %v, %v, want 2", got, err)
+	}
+}
+
+func TestLoader_StaleWhileRevalidate(t *testing.T) {
+	t.Parallel()
+
+	store := kvinmemory.New()
+	ctx := context.Background()
+
+	var now atomic.Int64
+	now.Store(time.Now().UnixNano())
+
+	refreshErrs := make(chan error, 1)
+	l := New(
+		store,
+		WithStaleWhileRevalidate(time.Minute),
+		WithRefreshBackoff(20*time.Millisecond),
+		WithRefreshErrorHandler(func(key string, err error) { refreshErrs <- err }),
+	)
+	l.now = func() time.Time { return time.Unix(0, now.Load()) }
+
+	var (
+		calls   atomic.Int32
+		failing atomic.Bool
+	)
+	errLoad := errors.New("api is down")
+	load := func(ctx context.Context) (any, error) {
+		if failing.Load() {
+			return nil, errLoad
+		}
+		return calls.Add(1), nil
+	}
+
+	v := l.GetOrLoad(ctx, "key", load, kvoptions.WithExpire(time.Minute))
+	if got, err := v.Int(); err != nil || got != 1 || kv.IsStale(v) {
+		t.Fatalf("GetOrLoad() got = %v, %v, stale %v, want fresh 1", got, err, kv.IsStale(v))
+	}
+
+	if ttl, err := store.TTL(ctx, "key"); err != nil || ttl <= time.Minute {
+		t.Errorf("TTL() got = %v, %v, want more than %v", ttl, err, time.Minute)
+	}
+
+	// Past the soft expiry a failing refresh keeps the stale value in place.
+	now.Add(int64(90 * time.Second))
+	failing.Store(true)
+
+	v = l.GetOrLoad(ctx, "key", load, kvoptions.WithExpire(time.Minute))
+	if got, err := v.Int(); err != nil || got != 1 || !kv.IsStale(v) {
+		t.Errorf("GetOrLoad() after soft expiry got = %v, %v, stale %v, want stale 1", got, err, kv.IsStale(v))
+	}
+
+	select {
+	case err := <-refreshErrs:
+		if !errors.Is(err, errLoad) {
+			t.Errorf("refresh error = %v, want %v", err, errLoad)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("refresh error handler was not called")
+	}
+
+	// Once the backoff has passed, the next stale read triggers another refresh, which succeeds.
+	failing.Store(false)
+	time.Sleep(50 * time.Millisecond)
+
+	v = l.GetOrLoad(ctx, "key", load, kvoptions.WithExpire(time.Minute))
+	if got, err := v.Int(); err != nil || got != 1 || !kv.IsStale(v) {
+		t.Errorf("GetOrLoad() during refresh got = %v, %v, stale %v, want stale 1", got, err, kv.IsStale(v))
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		v = l.GetOrLoad(ctx, "key", load, kvoptions.WithExpire(time.Minute))
+		if !kv.IsStale(v) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("GetOrLoad() still returns a stale value after the refresh")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if got, err := v.Int(); err != nil || got != 2 {
+		t.Errorf("GetOrLoad() after refresh got = %v, %v, want 2", got, err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("loader called %d times, want 2", n)
+	}
+}
+
+func TestLoader_NegativeCaching(t *testing.T) {
+	t.Parallel()
+
+	store := kvinmemory.New()
+	l := New(store, WithNegativeCaching(50*time.Millisecond))
+	ctx := context.Background()
+
+	if err := l.Get(ctx, "user:1").Err(); !errors.Is(err, kv.ErrKeyNil) {
+		t.Errorf("Get() before load error = %v, want %v", err, kv.ErrKeyNil)
+	}
+
+	var calls atomic.Int32
+	load := func(ctx context.Context) (any, error) {
+		calls.Add(1)
+		return nil, fmt.Errorf("user not found: %w", kv.ErrKeyNil)
+	}
+
+	for range 3 {
+		if err := l.GetOrLoad(ctx, "user:1", load).Err(); !errors.Is(err, kv.ErrNegativeCached) {
+			t.Errorf("GetOrLoad() error = %v, want %v", err, kv.ErrNegativeCached)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("loader called %d times, want 1", n)
+	}
+
+	if err := l.Get(ctx, "user:1").Err(); !errors.Is(err, kv.ErrNegativeCached) {
+		t.Errorf("Get() after negative load error = %v, want %v", err, kv.ErrNegativeCached)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if err := l.Get(ctx, "user:1").Err(); !errors.Is(err, kv.ErrKeyNil) {
+		t.Errorf("Get() after negative entry expired error = %v, want %v", err, kv.ErrKeyNil)
+	}
+
+	if err := l.SetNegative(ctx, "user:2"); err != nil {
+		t.Fatalf("SetNegative() error = %v", err)
+	}
+	if err := l.Get(ctx, "user:2").Err(); !errors.Is(err, kv.ErrNegativeCached) {
+		t.Errorf("Get() after SetNegative() error = %v, want %v", err, kv.ErrNegativeCached)
+	}
+
+	if err := New(store).SetNegative(ctx, "user:3"); !errors.Is(err, kv.ErrNotSupported) {
+		t.Errorf("SetNegative() without negative caching error = %v, want %v", err, kv.ErrNotSupported)
+	}
+}
+
+func TestLoader_EarlyExpirationRefreshError(t *testing.T) {
+	t.Parallel()
+
+	store := kvinmemory.New()
+	ctx := context.Background()
+
+	refreshErrs := make(chan error, 1)
+	now := time.Now()
+	l := New(
+		store,
+		WithEarlyExpiration(1),
+		WithRefreshBackoff(50*time.Millisecond),
+		WithRefreshErrorHandler(func(key string, err error) { refreshErrs <- err }),
+	)
+	l.now = func() time.Time { return now }
+
+	var (
+		calls   atomic.Int32
+		failing bool
+	)
+	errLoad := errors.New("api is down")
+	load := func(ctx context.Context) (any, error) {
+		if failing {
+			return nil, errLoad
+		}
+		// Pretend the load takes a second.
+		now = now.Add(time.Second)
+		return calls.Add(1), nil
+	}
+
+	if got, err := l.GetOrLoad(ctx, "key", load, kvoptions.WithExpire(time.Minute)).Int(); err != nil || got != 1 {
+		t.Fatalf("GetOrLoad() got = %v, %v, want 1", got, err)
+	}
+
+	// Right before the expiry the early refresh fails, and the still valid value is served.
+	now = now.Add(time.Minute - time.Microsecond)
+	failing = true
+	if got, err := l.GetOrLoad(ctx, "key", load, kvoptions.WithExpire(time.Minute)).Int(); err != nil || got != 1 {
+		t.Errorf("GetOrLoad() with a failing refresh got = %v, %v, want 1", got, err)
+	}
+	if err := <-refreshErrs; !errors.Is(err, errLoad) {
+		t.Errorf("refresh error = %v, want %v", err, errLoad)
+	}
+
+	// The lock is kept for the backoff, so reads in the meantime do not refresh.
+	failing = false
+	if exists, err := store.Exists(ctx, "key"+refreshLockSuffix); err != nil || !exists {
+		t.Fatalf("Exists() lock after failed refresh got = %v, %v, want true", exists, err)
+	}
+	if got, err := l.GetOrLoad(ctx, "key", load, kvoptions.WithExpire(time.Minute)).Int(); err != nil || got != 1 {
+		t.Errorf("GetOrLoad() during backoff got = %v, %v, want 1", got, err)
+	}
+
+	// After the backoff a later read takes the lock again and refreshes the value.
+	time.Sleep(100 * time.Millisecond)
+	if got, err := l.GetOrLoad(ctx, "key", load, kvoptions.WithExpire(time.Minute)).Int(); err != nil || got != 2 {
+		t.Errorf("GetOrLoad() retried refresh got = %v, %v, want 2", got, err)
+	}
+}
+
+func TestLoader_StaleRefreshBackoff(t *testing.T) {
+	t.Parallel()
+
+	store := kvinmemory.New()
+	ctx := context.Background()
+
+	var now atomic.Int64
+	now.Store(time.Now().UnixNano())
+
+	refreshErrs := make(chan error, 1)
+	l := New(
+		store,
+		WithStaleWhileRevalidate(time.Minute),
+		WithRefreshBackoff(100*time.Millisecond),
+		WithRefreshErrorHandler(func(key string, err error) { refreshErrs <- err }),
+	)
+	l.now = func() time.Time { return time.Unix(0, now.Load()) }
+
+	var (
+		calls   atomic.Int32
+		failing atomic.Bool
+	)
+	load := func(ctx context.Context) (any, error) {
+		calls.Add(1)
+		if failing.Load() {
+			return nil, errors.New("api is down")
+		}
+		return 1, nil
+	}
+
+	if err := l.GetOrLoad(ctx, "key", load, kvoptions.WithExpire(time.Minute)).Err(); err != nil {
+		t.Fatalf("GetOrLoad() error = %v", err)
+	}
+
+	now.Add(int64(90 * time.Second))
+	failing.Store(true)
+
+	if v := l.GetOrLoad(ctx, "key", load, kvoptions.WithExpire(time.Minute)); !kv.IsStale(v) {
+		t.Fatalf("GetOrLoad() after soft expiry stale = %v, want true", kv.IsStale(v))
+	}
+	<-refreshErrs
+
+	// Stale reads within the backoff do not call the failing loader again.
+	for range 10 {
+		if v := l.GetOrLoad(ctx, "key", load, kvoptions.WithExpire(time.Minute)); !kv.IsStale(v) {
+			t.Fatalf("GetOrLoad() during backoff stale = %v, want true", kv.IsStale(v))
+		}
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("loader called %d times during backoff, want 2", n)
+	}
+
+	// After the backoff the next stale read retries.
+	time.Sleep(150 * time.Millisecond)
+	l.GetOrLoad(ctx, "key", load, kvoptions.WithExpire(time.Minute))
+	select {
+	case <-refreshErrs:
+	case <-time.After(time.Second):
+		t.Fatal("refresh was not retried after the backoff")
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("loader called %d times after backoff, want 3", n)
+	}
+}
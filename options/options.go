@@ -8,6 +8,10 @@ type Option func(*Options)
 
 type Options struct {
 	Expire time.Duration
+	// OnlyIfNotExists makes Set write the value only if the key does not exist yet.
+	OnlyIfNotExists bool
+	// OnlyIfExists makes Set write the value only if the key already exists.
+	OnlyIfExists bool
 }
 
 func Construct(options ...Option) Options {
@@ -19,8 +23,28 @@ func Construct(options ...Option) Options {
 	return opts
 }
 
+// WithExpire sets the time to live of a key.
+// For counter operations (Incr, IncrBy, IncrByFloat, Decr) it is applied only when the key is created.
 func WithExpire(d time.Duration) Option {
 	return func(o *Options) {
 		o.Expire = d
 	}
 }
+
+// WithOnlyIfNotExists makes Set write the value only if the key does not exist (SET NX).
+// Set returns kv.ErrNotSet when the key already exists.
+func WithOnlyIfNotExists() Option {
+	return func(o *Options) {
+		o.OnlyIfNotExists = true
+		o.OnlyIfExists = false
+	}
+}
+
+// WithOnlyIfExists makes Set write the value only if the key already exists (SET XX).
+// Set returns kv.ErrNotSet when the key does not exist.
+func WithOnlyIfExists() Option {
+	return func(o *Options) {
+		o.OnlyIfExists = true
+		o.OnlyIfNotExists = false
+	}
+}
@@ -0,0 +1,192 @@
+package kv
+
+import (
+	"context"
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	kvcodec "github.com/twirapp/kv/codec"
+	kvoptions "github.com/twirapp/kv/options"
+)
+
+// RepositoryIDPlaceholder is the placeholder replaced by the id in repository key templates.
+const RepositoryIDPlaceholder = "{id}"
+
+// Repository is a typed view over a KV store where every value of type V is stored under
+// a key built from a template such as "channel:{id}:settings".
+type Repository[K any, V any] struct {
+	store    KV
+	codec    kvcodec.Codec
+	template string
+}
+
+// NewRepository creates a Repository storing values in store under keys built from template.
+// The template must contain RepositoryIDPlaceholder exactly once, NewRepository panics otherwise.
+// If codec is nil, the store's codec is used. Values encoded with another codec are handed to
+// the store as bytes, so the store's codec must write []byte unchanged, as kvcodec.Default does.
+func NewRepository[K any, V any](store KV, template string, codec kvcodec.Codec) *Repository[K, V] {
+	if strings.Count(template, RepositoryIDPlaceholder) != 1 {
+		panic(fmt.Sprintf("kv: repository key template %q must contain %s exactly once", template, RepositoryIDPlaceholder))
+	}
+
+	if codec == nil {
+		codec = CodecOf(store)
+	}
+
+	return &Repository[K, V]{
+		store:    store,
+		codec:    codec,
+		template: template,
+	}
+}
+
+// Key returns the store key for id.
+func (r *Repository[K, V]) Key(id K) string {
+	return strings.Replace(r.template, RepositoryIDPlaceholder, fmt.Sprint(id), 1)
+}
+
+// Get returns the value stored for id. It returns ErrKeyNil if there is none.
+func (r *Repository[K, V]) Get(ctx context.Context, id K) (V, error) {
+	return decodeAs[V](r.codec, r.store.Get(ctx, r.Key(id)))
+}
+
+// GetMany returns the values stored for ids.
+// The order of values and errors corresponds to the order of the ids provided;
+// a missing id yields the zero value of V and ErrKeyNil at its position.
+func (r *Repository[K, V]) GetMany(ctx context.Context, ids []K) ([]V, []error) {
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = r.Key(id)
+	}
+
+	return r.getMany(ctx, keys)
+}
+
+// Set stores value for id.
+func (r *Repository[K, V]) Set(ctx context.Context, id K, value V, options ...kvoptions.Option) error {
+	if sameCodec(r.codec, CodecOf(r.store)) {
+		return r.store.Set(ctx, r.Key(id), value, options...)
+	}
+
+	data, err := r.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return r.store.Set(ctx, r.Key(id), data, options...)
+}
+
+// Delete removes the value stored for id.
+func (r *Repository[K, V]) Delete(ctx context.Context, id K) error {
+	return r.store.Delete(ctx, r.Key(id))
+}
+
+// Exists reports whether a value is stored for id.
+func (r *Repository[K, V]) Exists(ctx context.Context, id K) (bool, error) {
+	return r.store.Exists(ctx, r.Key(id))
+}
+
+// List returns every value stored under the repository's key template.
+// Keys that disappear between listing and reading are skipped, and so are keys matching the
+// template's prefix and suffix whose id does not parse as K, such as "user:1:sessions:x" for
+// the template "user:{id}" with numeric ids.
+func (r *Repository[K, V]) List(ctx context.Context) ([]V, error) {
+	matched, err := r.store.GetKeysByPattern(ctx, r.pattern())
+	if err != nil {
+		return nil, err
+	}
+
+	keys := matched[:0]
+	for _, key := range matched {
+		if _, ok := r.parseID(key); ok {
+			keys = append(keys, key)
+		}
+	}
+
+	values, errs := r.getMany(ctx, keys)
+
+	result := make([]V, 0, len(values))
+	for i, v := range values {
+		if errors.Is(errs[i], ErrKeyNil) {
+			continue
+		}
+		if errs[i] != nil {
+			return nil, fmt.Errorf("failed to get %s: %w", keys[i], errs[i])
+		}
+		result = append(result, v)
+	}
+
+	return result, nil
+}
+
+func (r *Repository[K, V]) getMany(ctx context.Context, keys []string) ([]V, []error) {
+	if len(keys) == 0 {
+		return []V{}, []error{}
+	}
+
+	valuers := r.store.GetMany(ctx, keys)
+
+	values := make([]V, len(valuers))
+	errs := make([]error, len(valuers))
+	for i, v := range valuers {
+		values[i], errs[i] = decodeAs[V](r.codec, v)
+	}
+
+	return values, errs
+}
+
+// pattern returns the glob pattern matching every key of the repository. Glob metacharacters
+// in the template itself are escaped so they match literally.
+func (r *Repository[K, V]) pattern() string {
+	prefix, suffix, _ := strings.Cut(r.template, RepositoryIDPlaceholder)
+
+	return escapePattern(prefix) + "*" + escapePattern(suffix)
+}
+
+// parseID returns the id key was built from. It reports false if key does not match the
+// template, or if the id does not parse as K or does not format back to key.
+func (r *Repository[K, V]) parseID(key string) (K, bool) {
+	var id K
+
+	prefix, suffix, _ := strings.Cut(r.template, RepositoryIDPlaceholder)
+	if len(key) < len(prefix)+len(suffix) || !strings.HasPrefix(key, prefix) || !strings.HasSuffix(key, suffix) {
+		return id, false
+	}
+	raw := key[len(prefix) : len(key)-len(suffix)]
+
+	if u, ok := any(&id).(encoding.TextUnmarshaler); ok {
+		if err := u.UnmarshalText([]byte(raw)); err != nil {
+			return id, false
+		}
+	} else if rv := reflect.ValueOf(&id).Elem(); rv.Kind() == reflect.String {
+		rv.SetString(raw)
+	} else if _, err := fmt.Sscan(raw, &id); err != nil {
+		return id, false
+	}
+
+	return id, r.Key(id) == key
+}
+
+// sameCodec reports whether a and b are the same codec. Codecs of non-comparable types are
+// never considered the same.
+func sameCodec(a, b kvcodec.Codec) bool {
+	t := reflect.TypeOf(a)
+
+	return t == reflect.TypeOf(b) && t != nil && t.Comparable() && a == b
+}
+
+func escapePattern(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+
+	return b.String()
+}
@@ -0,0 +1,48 @@
+package kv_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/twirapp/kv"
+	kvcodec "github.com/twirapp/kv/codec"
+	kvinmemory "github.com/twirapp/kv/stores/inmemory"
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(value any) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (jsonCodec) Unmarshal(data []byte, dest any) error {
+	return json.Unmarshal(data, dest)
+}
+
+func TestRepository_StoreCodec(t *testing.T) {
+	t.Parallel()
+
+	type settings struct {
+		Prefix string `json:"prefix"`
+	}
+
+	store := kvinmemory.New(kvinmemory.WithCodec(jsonCodec{}))
+	ctx := context.Background()
+
+	for _, codec := range []kvcodec.Codec{nil, jsonCodec{}} {
+		repo := kv.NewRepository[int, settings](store, "channel:{id}:settings", codec)
+
+		if err := repo.Set(ctx, 1, settings{Prefix: "!"}); err != nil {
+			t.Fatalf("Set() error = %v", err)
+		}
+
+		// The value is encoded once, not marshalled to bytes and encoded again by the store.
+		if got, err := store.Get(ctx, "channel:1:settings").String(); err != nil || got != `{"prefix":"!"}` {
+			t.Errorf("Get() stored value got = %v, %v, want %s", got, err, `{"prefix":"!"}`)
+		}
+		if got, err := repo.Get(ctx, 1); err != nil || got.Prefix != "!" {
+			t.Errorf("Get() got = %v, %v, want prefix !", got, err)
+		}
+	}
+}
@@ -2,49 +2,171 @@ package kvinmemory
 
 import (
 	"context"
-	"strings"
+	"errors"
+	"fmt"
+	"iter"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/twirapp/kv"
+	kvcodec "github.com/twirapp/kv/codec"
 	"github.com/twirapp/kv/internal/matchpattern"
-	"github.com/twirapp/kv/internal/tobytes"
+	"github.com/twirapp/kv/internal/valueversion"
 	kvoptions "github.com/twirapp/kv/options"
 	kvvaluer "github.com/twirapp/kv/valuer"
 )
 
 var _ kv.KV = (*InMemory)(nil)
+var _ kv.CodecProvider = (*InMemory)(nil)
+var _ kv.TTLManyProvider = (*InMemory)(nil)
 
 type inMemoryValue struct {
-	value  []byte
-	expire time.Duration
+	value []byte
+	// expiresAt is the absolute deadline of the value. Zero means the value never expires.
+	expiresAt time.Time
+	// version changes on every write of the value.
+	version uint64
+}
+
+func (v inMemoryValue) expired(now time.Time) bool {
+	return !v.expiresAt.IsZero() && !now.Before(v.expiresAt)
+}
+
+func newInMemoryValue(value []byte, expire time.Duration) inMemoryValue {
+	v := inMemoryValue{value: value, version: valueversion.Next()}
+	if expire > 0 {
+		v.expiresAt = time.Now().Add(expire)
+	}
+
+	return v
+}
+
+type Option func(*InMemory)
+
+// WithCleanupInterval starts a background janitor that removes expired keys every d.
+// The janitor is stopped by Close.
+func WithCleanupInterval(d time.Duration) Option {
+	return func(c *InMemory) {
+		c.cleanupInterval = d
+	}
+}
+
+// WithCodec sets the codec used to encode values. Defaults to kvcodec.Default.
+func WithCodec(codec kvcodec.Codec) Option {
+	return func(c *InMemory) {
+		c.codec = codec
+	}
 }
 
 type InMemory struct {
 	storage map[string]inMemoryValue
 	mu      sync.RWMutex
+	codec   kvcodec.Codec
+
+	cleanupInterval time.Duration
+	stop            chan struct{}
+	stopOnce        sync.Once
+	done            chan struct{}
 }
 
-func New() *InMemory {
-	return &InMemory{
+func New(options ...Option) *InMemory {
+	c := &InMemory{
 		storage: make(map[string]inMemoryValue),
 		mu:      sync.RWMutex{},
+		codec:   kvcodec.Default,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	for _, o := range options {
+		o(c)
+	}
+
+	if c.cleanupInterval > 0 {
+		go c.janitor()
+	} else {
+		close(c.done)
+	}
+
+	return c
+}
+
+// Codec returns the codec used to encode values.
+func (c *InMemory) Codec() kvcodec.Codec {
+	return c.codec
+}
+
+// Close stops the background janitor, if any. It is safe to call Close multiple times.
+func (c *InMemory) Close() error {
+	c.stopOnce.Do(func() {
+		close(c.stop)
+	})
+	<-c.done
+
+	return nil
+}
+
+func (c *InMemory) janitor() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(c.cleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			c.deleteExpired()
+		}
+	}
+}
+
+func (c *InMemory) deleteExpired() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for key, v := range c.storage {
+		if v.expired(now) {
+			delete(c.storage, key)
+		}
+	}
+}
+
+// lookup returns the value stored under key, treating expired values as missing.
+// The caller must hold at least a read lock.
+func (c *InMemory) lookup(key string, now time.Time) (inMemoryValue, bool) {
+	v, ok := c.storage[key]
+	if !ok || v.expired(now) {
+		return inMemoryValue{}, false
+	}
+
+	return v, true
+}
+
+// evict removes key if it is still expired. It must be called without holding the lock.
+func (c *InMemory) evict(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if v, ok := c.storage[key]; ok && v.expired(time.Now()) {
+		delete(c.storage, key)
 	}
 }
 
 func (c *InMemory) Get(_ context.Context, key string) kv.Valuer {
 	c.mu.RLock()
-	defer c.mu.RUnlock()
-
 	v, ok := c.storage[key]
+	c.mu.RUnlock()
+
 	if !ok {
 		return &kvvaluer.Valuer{Error: kv.ErrKeyNil}
 	}
 
-	if v.expire > 0 && time.Since(time.Unix(0, 0)) > v.expire {
-		c.mu.Lock()
-		delete(c.storage, key)
-		c.mu.Unlock()
+	if v.expired(time.Now()) {
+		c.evict(key)
 
 		return &kvvaluer.Valuer{Error: kv.ErrKeyNil}
 	}
@@ -52,8 +174,29 @@ func (c *InMemory) Get(_ context.Context, key string) kv.Valuer {
 	return &kvvaluer.Valuer{Value: v.value}
 }
 
+func (c *InMemory) GetMany(_ context.Context, keys []string) []kv.Valuer {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var (
+		results = make([]kv.Valuer, len(keys))
+		now     = time.Now()
+	)
+	for i, key := range keys {
+		v, ok := c.lookup(key, now)
+		if !ok {
+			results[i] = &kvvaluer.Valuer{Error: kv.ErrKeyNil}
+			continue
+		}
+
+		results[i] = &kvvaluer.Valuer{Value: v.value}
+	}
+
+	return results
+}
+
 func (c *InMemory) Set(_ context.Context, key string, value any, options ...kvoptions.Option) error {
-	b, err := tobytes.ToBytes(value)
+	b, err := c.codec.Marshal(value)
 	if err != nil {
 		return err
 	}
@@ -62,32 +205,48 @@ func (c *InMemory) Set(_ context.Context, key string, value any, options ...kvop
 	defer c.mu.Unlock()
 
 	o := kvoptions.Construct(options...)
-	c.storage[key] = inMemoryValue{
-		value:  b,
-		expire: o.Expire,
+	if o.OnlyIfNotExists || o.OnlyIfExists {
+		_, exists := c.lookup(key, time.Now())
+		if exists == o.OnlyIfNotExists {
+			return kv.ErrNotSet
+		}
 	}
 
+	c.storage[key] = newInMemoryValue(b, o.Expire)
+
 	return nil
 }
 
+// SetMany writes every value whose condition is met and returns the errors of the skipped
+// keys joined together.
 func (c *InMemory) SetMany(_ context.Context, values []kv.SetMany) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	var (
+		errs []error
+		now  = time.Now()
+	)
+
 	for _, v := range values {
-		b, err := tobytes.ToBytes(v.Value)
+		b, err := c.codec.Marshal(v.Value)
 		if err != nil {
 			return err
 		}
 
 		o := kvoptions.Construct(v.Options...)
-		c.storage[v.Key] = inMemoryValue{
-			value:  b,
-			expire: o.Expire,
+		if o.OnlyIfNotExists || o.OnlyIfExists {
+			_, exists := c.lookup(v.Key, now)
+			if exists == o.OnlyIfNotExists {
+				errs = append(errs, fmt.Errorf("failed to set key %s: %w", v.Key, kv.ErrNotSet))
+				continue
+			}
 		}
+
+		c.storage[v.Key] = newInMemoryValue(b, o.Expire)
 	}
 
-	return nil
+	return errors.Join(errs...)
 }
 
 func (c *InMemory) Delete(_ context.Context, key string) error {
@@ -112,7 +271,7 @@ func (c *InMemory) Exists(ctx context.Context, key string) (bool, error) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	_, ok := c.storage[key]
+	_, ok := c.lookup(key, time.Now())
 	return ok, nil
 }
 
@@ -120,9 +279,12 @@ func (c *InMemory) ExistsMany(ctx context.Context, keys []string) ([]bool, error
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	results := make([]bool, len(keys))
+	var (
+		results = make([]bool, len(keys))
+		now     = time.Now()
+	)
 	for i, key := range keys {
-		_, ok := c.storage[key]
+		_, ok := c.lookup(key, now)
 		results[i] = ok
 	}
 
@@ -134,16 +296,232 @@ func (c *InMemory) GetKeysByPattern(ctx context.Context, pattern string) ([]stri
 	defer c.mu.RUnlock()
 
 	var (
-		keys         []string
-		patternParts = strings.Split(pattern, ":")
+		keys []string
+		now  = time.Now()
 	)
 
-	for key := range c.storage {
-		keyParts := strings.Split(key, ":")
-		if matchpattern.MatchPattern(patternParts, keyParts) {
+	for key, v := range c.storage {
+		if v.expired(now) {
+			continue
+		}
+
+		if matchpattern.MatchPattern(pattern, key) {
 			keys = append(keys, key)
 		}
 	}
 
 	return keys, nil
 }
+
+// ScanKeys iterates over a snapshot of the matching keys taken when iteration starts,
+// so the store is not locked while the caller consumes the keys.
+func (c *InMemory) ScanKeys(ctx context.Context, pattern string) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		keys, err := c.GetKeysByPattern(ctx, pattern)
+		if err != nil {
+			yield("", err)
+			return
+		}
+
+		for _, key := range keys {
+			if err := ctx.Err(); err != nil {
+				yield("", err)
+				return
+			}
+			if !yield(key, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (c *InMemory) DeleteByPattern(_ context.Context, pattern string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var (
+		deleted int64
+		now     = time.Now()
+	)
+
+	for key, v := range c.storage {
+		if !matchpattern.MatchPattern(pattern, key) {
+			continue
+		}
+
+		delete(c.storage, key)
+		if !v.expired(now) {
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+func (c *InMemory) Incr(ctx context.Context, key string, options ...kvoptions.Option) (int64, error) {
+	return c.IncrBy(ctx, key, 1, options...)
+}
+
+func (c *InMemory) IncrBy(_ context.Context, key string, delta int64, options ...kvoptions.Option) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var result int64
+
+	v, ok := c.lookup(key, time.Now())
+	if !ok {
+		v = newInMemoryValue(nil, kvoptions.Construct(options...).Expire)
+	} else {
+		n, err := strconv.ParseInt(string(v.value), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("value of key %s is not an integer: %w", key, kv.ErrInvalidType)
+		}
+		result = n
+	}
+
+	result += delta
+	v.value = []byte(strconv.FormatInt(result, 10))
+	v.version = valueversion.Next()
+	c.storage[key] = v
+
+	return result, nil
+}
+
+func (c *InMemory) IncrByFloat(_ context.Context, key string, delta float64, options ...kvoptions.Option) (float64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var result float64
+
+	v, ok := c.lookup(key, time.Now())
+	if !ok {
+		v = newInMemoryValue(nil, kvoptions.Construct(options...).Expire)
+	} else {
+		f, err := strconv.ParseFloat(string(v.value), 64)
+		if err != nil {
+			return 0, fmt.Errorf("value of key %s is not a float: %w", key, kv.ErrInvalidType)
+		}
+		result = f
+	}
+
+	result += delta
+	v.value = []byte(strconv.FormatFloat(result, 'f', -1, 64))
+	v.version = valueversion.Next()
+	c.storage[key] = v
+
+	return result, nil
+}
+
+func (c *InMemory) Decr(ctx context.Context, key string, options ...kvoptions.Option) (int64, error) {
+	return c.IncrBy(ctx, key, -1, options...)
+}
+
+func (c *InMemory) TTL(_ context.Context, key string) (time.Duration, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := time.Now()
+	v, ok := c.lookup(key, now)
+	if !ok {
+		return 0, kv.ErrKeyNil
+	}
+
+	if v.expiresAt.IsZero() {
+		return kv.NoExpiration, nil
+	}
+
+	return v.expiresAt.Sub(now), nil
+}
+
+func (c *InMemory) TTLMany(_ context.Context, keys []string) ([]time.Duration, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := time.Now()
+	results := make([]time.Duration, len(keys))
+	for i, key := range keys {
+		v, ok := c.lookup(key, now)
+		switch {
+		case !ok:
+		case v.expiresAt.IsZero():
+			results[i] = kv.NoExpiration
+		default:
+			results[i] = v.expiresAt.Sub(now)
+		}
+	}
+
+	return results, nil
+}
+
+func (c *InMemory) Expire(_ context.Context, key string, d time.Duration) error {
+	return c.setExpiresAt(key, time.Now().Add(d))
+}
+
+func (c *InMemory) ExpireAt(_ context.Context, key string, t time.Time) error {
+	return c.setExpiresAt(key, t)
+}
+
+func (c *InMemory) Persist(_ context.Context, key string) error {
+	return c.setExpiresAt(key, time.Time{})
+}
+
+// setExpiresAt changes the deadline of an existing key. A zero t removes the expiration,
+// a t in the past deletes the key.
+func (c *InMemory) setExpiresAt(key string, t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	v, ok := c.lookup(key, now)
+	if !ok {
+		return kv.ErrKeyNil
+	}
+
+	if !t.IsZero() && !now.Before(t) {
+		delete(c.storage, key)
+		return nil
+	}
+
+	v.expiresAt = t
+	c.storage[key] = v
+
+	return nil
+}
+
+func (c *InMemory) GetWithVersion(_ context.Context, key string) (kv.Valuer, kv.Version) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	v, ok := c.lookup(key, time.Now())
+	if !ok {
+		return &kvvaluer.Valuer{Error: kv.ErrKeyNil}, ""
+	}
+
+	return &kvvaluer.Valuer{Value: v.value}, kv.Version(strconv.FormatUint(v.version, 10))
+}
+
+func (c *InMemory) CompareAndSwap(
+	_ context.Context,
+	key string,
+	version kv.Version,
+	value any,
+	options ...kvoptions.Option,
+) error {
+	b, err := c.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	v, ok := c.lookup(key, time.Now())
+	if !ok || kv.Version(strconv.FormatUint(v.version, 10)) != version {
+		return kv.ErrVersionMismatch
+	}
+
+	o := kvoptions.Construct(options...)
+	c.storage[key] = newInMemoryValue(b, o.Expire)
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package kvinmemory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/twirapp/kv"
+	kvoptions "github.com/twirapp/kv/options"
+)
+
+func TestInMemory_Expire(t *testing.T) {
+	t.Parallel()
+
+	c := New()
+	defer c.Close()
+
+	ctx := context.Background()
+
+	if err := c.Set(ctx, "user:1", "value", kvoptions.WithExpire(50*time.Millisecond)); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := c.Set(ctx, "user:2", "value"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	if err := c.Get(ctx, "user:1").Err(); err != nil {
+		t.Fatalf("Get() before expiry error = %v, wantErr %v", err, false)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if err := c.Get(ctx, "user:1").Err(); !errors.Is(err, kv.ErrKeyNil) {
+		t.Errorf("Get() after expiry error = %v, want %v", err, kv.ErrKeyNil)
+	}
+
+	if err := c.GetMany(ctx, []string{"user:1"})[0].Err(); !errors.Is(err, kv.ErrKeyNil) {
+		t.Errorf("GetMany() after expiry error = %v, want %v", err, kv.ErrKeyNil)
+	}
+
+	exists, err := c.Exists(ctx, "user:1")
+	if err != nil || exists {
+		t.Errorf("Exists() after expiry got = %v, %v, want false", exists, err)
+	}
+
+	existsMany, err := c.ExistsMany(ctx, []string{"user:1", "user:2"})
+	if err != nil || existsMany[0] || !existsMany[1] {
+		t.Errorf("ExistsMany() after expiry got = %v, %v, want [false true]", existsMany, err)
+	}
+
+	keys, err := c.GetKeysByPattern(ctx, "user:*")
+	if err != nil || len(keys) != 1 || keys[0] != "user:2" {
+		t.Errorf("GetKeysByPattern() after expiry got = %v, %v, want [user:2]", keys, err)
+	}
+}
+
+func TestInMemory_Janitor(t *testing.T) {
+	t.Parallel()
+
+	c := New(WithCleanupInterval(10 * time.Millisecond))
+
+	if err := c.Set(context.Background(), "key1", "value", kvoptions.WithExpire(20*time.Millisecond)); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	c.mu.RLock()
+	n := len(c.storage)
+	c.mu.RUnlock()
+
+	if n != 0 {
+		t.Errorf("janitor did not remove expired keys, %d left", n)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Errorf("second Close() error = %v", err)
+	}
+}
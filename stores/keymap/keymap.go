@@ -0,0 +1,236 @@
+package kvkeymap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"time"
+
+	"github.com/twirapp/kv"
+	kvcodec "github.com/twirapp/kv/codec"
+	"github.com/twirapp/kv/internal/keyseal"
+	kvoptions "github.com/twirapp/kv/options"
+	kvvaluer "github.com/twirapp/kv/valuer"
+)
+
+var _ kv.KV = (*KeyMap)(nil)
+var _ kv.CodecProvider = (*KeyMap)(nil)
+
+// Mapper returns the key a key is stored under. It must be deterministic.
+type Mapper func(key string) string
+
+// KeyMap stores every key of the underlying store under the key returned by a Mapper, for
+// example kvmemcached.SafeKey. Values stored under a key the mapper changed are prefixed with
+// the original key, so reading a key stored under the same key as another one reports
+// kv.ErrKeyCollision, whether or not the mapper changed it.
+//
+// Stored keys cannot be mapped back, so pattern operations are not supported. Counters are
+// stored unprefixed, so collisions between mapped counter keys are not detected.
+type KeyMap struct {
+	store  kv.KV
+	mapKey Mapper
+}
+
+func New(store kv.KV, mapKey Mapper) *KeyMap {
+	return &KeyMap{
+		store:  store,
+		mapKey: mapKey,
+	}
+}
+
+// Codec returns the codec of the underlying store.
+func (c *KeyMap) Codec() kvcodec.Codec {
+	return kv.CodecOf(c.store)
+}
+
+func (c *KeyMap) mapKeys(keys []string) []string {
+	mapped := make([]string, len(keys))
+	for i, key := range keys {
+		mapped[i] = c.mapKey(key)
+	}
+
+	return mapped
+}
+
+// encode marshals value and seals it with key if key is stored under another key.
+func (c *KeyMap) encode(key, stored string, value any) (any, error) {
+	if stored == key {
+		return value, nil
+	}
+
+	data, err := c.Codec().Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return keyseal.Seal(key, data), nil
+}
+
+// decode checks that a value read for key was written for it. Values of keys the mapper left
+// unchanged are checked as well, since another key may have been mapped to key itself.
+func decode(key string, v kv.Valuer) kv.Valuer {
+	if v.Err() != nil {
+		return v
+	}
+
+	data, _ := v.Bytes()
+	value, err := keyseal.Check(key, data)
+	if err != nil {
+		return &kvvaluer.Valuer{Error: err}
+	}
+
+	return &kvvaluer.Valuer{Value: value, Stale: kv.IsStale(v)}
+}
+
+func (c *KeyMap) Get(ctx context.Context, key string) kv.Valuer {
+	stored := c.mapKey(key)
+	return decode(key, c.store.Get(ctx, stored))
+}
+
+func (c *KeyMap) GetMany(ctx context.Context, keys []string) []kv.Valuer {
+	stored := c.mapKeys(keys)
+
+	results := c.store.GetMany(ctx, stored)
+	for i, v := range results {
+		results[i] = decode(keys[i], v)
+	}
+
+	return results
+}
+
+func (c *KeyMap) Set(ctx context.Context, key string, value any, options ...kvoptions.Option) error {
+	stored := c.mapKey(key)
+
+	value, err := c.encode(key, stored, value)
+	if err != nil {
+		return err
+	}
+
+	return c.store.Set(ctx, stored, value, options...)
+}
+
+func (c *KeyMap) SetMany(ctx context.Context, values []kv.SetMany) error {
+	mapped := make([]kv.SetMany, len(values))
+	for i, v := range values {
+		stored := c.mapKey(v.Key)
+
+		value, err := c.encode(v.Key, stored, v.Value)
+		if err != nil {
+			return err
+		}
+
+		mapped[i] = kv.SetMany{Key: stored, Value: value, Options: v.Options}
+	}
+
+	return c.store.SetMany(ctx, mapped)
+}
+
+func (c *KeyMap) Delete(ctx context.Context, key string) error {
+	return c.store.Delete(ctx, c.mapKey(key))
+}
+
+func (c *KeyMap) DeleteMany(ctx context.Context, keys []string) error {
+	return c.store.DeleteMany(ctx, c.mapKeys(keys))
+}
+
+// Exists reads mapped keys instead of checking their existence, so it can report collisions.
+func (c *KeyMap) Exists(ctx context.Context, key string) (bool, error) {
+	results, err := c.ExistsMany(ctx, []string{key})
+	if err != nil {
+		return false, err
+	}
+
+	return results[0], nil
+}
+
+func (c *KeyMap) ExistsMany(ctx context.Context, keys []string) ([]bool, error) {
+	// Values are read to check their seals, so a key another key was mapped to is not reported
+	// as existing.
+	results := make([]bool, len(keys))
+	for i, v := range c.GetMany(ctx, keys) {
+		switch err := v.Err(); {
+		case err == nil:
+			results[i] = true
+		case !errors.Is(err, kv.ErrKeyNil):
+			return nil, err
+		}
+	}
+
+	return results, nil
+}
+
+func (c *KeyMap) GetKeysByPattern(_ context.Context, _ string) ([]string, error) {
+	return nil, fmt.Errorf("GetKeysByPattern is not supported with mapped keys: %w", kv.ErrNotSupported)
+}
+
+func (c *KeyMap) ScanKeys(_ context.Context, _ string) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		yield("", fmt.Errorf("ScanKeys is not supported with mapped keys: %w", kv.ErrNotSupported))
+	}
+}
+
+func (c *KeyMap) DeleteByPattern(_ context.Context, _ string) (int64, error) {
+	return 0, fmt.Errorf("DeleteByPattern is not supported with mapped keys: %w", kv.ErrNotSupported)
+}
+
+func (c *KeyMap) Incr(ctx context.Context, key string, options ...kvoptions.Option) (int64, error) {
+	return c.store.Incr(ctx, c.mapKey(key), options...)
+}
+
+func (c *KeyMap) IncrBy(ctx context.Context, key string, delta int64, options ...kvoptions.Option) (int64, error) {
+	return c.store.IncrBy(ctx, c.mapKey(key), delta, options...)
+}
+
+func (c *KeyMap) IncrByFloat(ctx context.Context, key string, delta float64, options ...kvoptions.Option) (float64, error) {
+	return c.store.IncrByFloat(ctx, c.mapKey(key), delta, options...)
+}
+
+func (c *KeyMap) Decr(ctx context.Context, key string, options ...kvoptions.Option) (int64, error) {
+	return c.store.Decr(ctx, c.mapKey(key), options...)
+}
+
+func (c *KeyMap) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return c.store.TTL(ctx, c.mapKey(key))
+}
+
+func (c *KeyMap) Expire(ctx context.Context, key string, d time.Duration) error {
+	return c.store.Expire(ctx, c.mapKey(key), d)
+}
+
+func (c *KeyMap) ExpireAt(ctx context.Context, key string, t time.Time) error {
+	return c.store.ExpireAt(ctx, c.mapKey(key), t)
+}
+
+func (c *KeyMap) Persist(ctx context.Context, key string) error {
+	return c.store.Persist(ctx, c.mapKey(key))
+}
+
+func (c *KeyMap) GetWithVersion(ctx context.Context, key string) (kv.Valuer, kv.Version) {
+	stored := c.mapKey(key)
+
+	v, version := c.store.GetWithVersion(ctx, stored)
+	v = decode(key, v)
+	if v.Err() != nil {
+		return v, ""
+	}
+
+	return v, version
+}
+
+func (c *KeyMap) CompareAndSwap(
+	ctx context.Context,
+	key string,
+	version kv.Version,
+	value any,
+	options ...kvoptions.Option,
+) error {
+	stored := c.mapKey(key)
+
+	value, err := c.encode(key, stored, value)
+	if err != nil {
+		return err
+	}
+
+	return c.store.CompareAndSwap(ctx, stored, version, value, options...)
+}
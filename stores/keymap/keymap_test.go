@@ -0,0 +1,123 @@
+package kvkeymap
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/twirapp/kv"
+	kvinmemory "github.com/twirapp/kv/stores/inmemory"
+	kvmemcached "github.com/twirapp/kv/stores/memcached"
+)
+
+func TestKeyMap_MappedKeys(t *testing.T) {
+	t.Parallel()
+
+	store := kvinmemory.New()
+	c := New(store, kvmemcached.SafeKey)
+	ctx := context.Background()
+
+	long := "channel:1:commands:" + strings.Repeat("x", 300)
+
+	for _, key := range []string{"plain", "with space", long} {
+		if err := c.Set(ctx, key, "value:"+key); err != nil {
+			t.Fatalf("Set(%q) error = %v", key, err)
+		}
+		if got, err := c.Get(ctx, key).String(); err != nil || got != "value:"+key {
+			t.Errorf("Get(%q) got = %v, %v, want value:%s", key, got, err, key)
+		}
+		if exists, err := c.Exists(ctx, key); err != nil || !exists {
+			t.Errorf("Exists(%q) got = %v, %v, want true", key, exists, err)
+		}
+	}
+
+	// Keys the mapper leaves unchanged are stored as is.
+	if got, err := store.Get(ctx, "plain").String(); err != nil || got != "value:plain" {
+		t.Errorf("Get() underlying plain got = %v, %v, want value:plain", got, err)
+	}
+	if exists, err := store.Exists(ctx, long); err != nil || exists {
+		t.Errorf("Exists() underlying long key got = %v, %v, want false", exists, err)
+	}
+
+	results := c.GetMany(ctx, []string{"with space", "missing key"})
+	if got, err := results[0].String(); err != nil || got != "value:with space" {
+		t.Errorf("GetMany()[0] got = %v, %v, want value:with space", got, err)
+	}
+	if err := results[1].Err(); !errors.Is(err, kv.ErrKeyNil) {
+		t.Errorf("GetMany()[1] error = %v, want %v", err, kv.ErrKeyNil)
+	}
+
+	if got, err := c.Incr(ctx, "counter with space"); err != nil || got != 1 {
+		t.Errorf("Incr() got = %v, %v, want 1", got, err)
+	}
+
+	if err := c.Delete(ctx, long); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if exists, err := c.Exists(ctx, long); err != nil || exists {
+		t.Errorf("Exists() after Delete() got = %v, %v, want false", exists, err)
+	}
+}
+
+func TestKeyMap_Collision(t *testing.T) {
+	t.Parallel()
+
+	c := New(kvinmemory.New(), func(key string) string {
+		return "same"
+	})
+	ctx := context.Background()
+
+	if err := c.Set(ctx, "a", "value"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	if got, err := c.Get(ctx, "a").String(); err != nil || got != "value" {
+		t.Errorf("Get() own key got = %v, %v, want value", got, err)
+	}
+
+	if err := c.Get(ctx, "b").Err(); !errors.Is(err, kv.ErrKeyCollision) {
+		t.Errorf("Get() colliding key error = %v, want %v", err, kv.ErrKeyCollision)
+	}
+	if _, err := c.Exists(ctx, "b"); !errors.Is(err, kv.ErrKeyCollision) {
+		t.Errorf("Exists() colliding key error = %v, want %v", err, kv.ErrKeyCollision)
+	}
+	if v, version := c.GetWithVersion(ctx, "b"); !errors.Is(v.Err(), kv.ErrKeyCollision) || version != "" {
+		t.Errorf("GetWithVersion() colliding key got = %v, %q, want %v", v.Err(), version, kv.ErrKeyCollision)
+	}
+
+	// A key the mapper leaves unchanged collides with a key mapped onto it.
+	c = New(kvinmemory.New(), func(key string) string {
+		if key == "a" {
+			return "b"
+		}
+		return key
+	})
+
+	if err := c.Set(ctx, "a", "value"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := c.Get(ctx, "b").Err(); !errors.Is(err, kv.ErrKeyCollision) {
+		t.Errorf("Get() unchanged colliding key error = %v, want %v", err, kv.ErrKeyCollision)
+	}
+	if results := c.GetMany(ctx, []string{"b"}); !errors.Is(results[0].Err(), kv.ErrKeyCollision) {
+		t.Errorf("GetMany() unchanged colliding key error = %v, want %v", results[0].Err(), kv.ErrKeyCollision)
+	}
+	if _, err := c.Exists(ctx, "b"); !errors.Is(err, kv.ErrKeyCollision) {
+		t.Errorf("Exists() unchanged colliding key error = %v, want %v", err, kv.ErrKeyCollision)
+	}
+}
+
+func TestKeyMap_PatternsNotSupported(t *testing.T) {
+	t.Parallel()
+
+	c := New(kvinmemory.New(), kvmemcached.SafeKey)
+	ctx := context.Background()
+
+	if _, err := c.GetKeysByPattern(ctx, "*"); !errors.Is(err, kv.ErrNotSupported) {
+		t.Errorf("GetKeysByPattern() error = %v, want %v", err, kv.ErrNotSupported)
+	}
+	if _, err := c.DeleteByPattern(ctx, "*"); !errors.Is(err, kv.ErrNotSupported) {
+		t.Errorf("DeleteByPattern() error = %v, want %v", err, kv.ErrNotSupported)
+	}
+}
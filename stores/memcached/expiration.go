@@ -0,0 +1,33 @@
+package kvmemcached
+
+import (
+	"math"
+	"time"
+)
+
+// maxRelativeExpiration is the longest expiration memcached reads as relative to the current
+// time. Larger values are read as absolute Unix timestamps.
+const maxRelativeExpiration = 30 * 24 * time.Hour
+
+// expiration converts a positive TTL to a memcached expiration. TTLs are rounded up to whole
+// seconds, as a zero expiration means the item never expires, and TTLs longer than 30 days
+// are converted to absolute timestamps.
+func expiration(d time.Duration, now time.Time) int32 {
+	if d > maxRelativeExpiration {
+		return expirationAt(now.Add(d))
+	}
+
+	return int32((d + time.Second - 1) / time.Second)
+}
+
+// expirationAt converts a point in time to an absolute memcached expiration, rounded up to
+// whole seconds. Deadlines past the 32-bit range memcached accepts, after January 2038, are
+// clamped to its end, as a wrapped negative value would expire the item immediately.
+func expirationAt(t time.Time) int32 {
+	unix := t.Unix()
+	if t.Nanosecond() > 0 {
+		unix++
+	}
+
+	return int32(min(unix, math.MaxInt32))
+}
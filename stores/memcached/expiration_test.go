@@ -0,0 +1,59 @@
+package kvmemcached
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestExpiration(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1700000000, 250_000_000)
+
+	tests := []struct {
+		name string
+		d    time.Duration
+		want int32
+	}{
+		{name: "sub-second", d: time.Nanosecond, want: 1},
+		{name: "half second", d: 500 * time.Millisecond, want: 1},
+		{name: "one second", d: time.Second, want: 1},
+		{name: "just over a second", d: time.Second + time.Millisecond, want: 2},
+		{name: "one hour", d: time.Hour, want: 3600},
+		{name: "just under 30 days", d: maxRelativeExpiration - time.Millisecond, want: 2592000},
+		{name: "30 days", d: maxRelativeExpiration, want: 2592000},
+		{name: "just over 30 days", d: maxRelativeExpiration + time.Millisecond, want: 1700000000 + 2592000 + 1},
+		{name: "30 days and a second", d: maxRelativeExpiration + time.Second, want: 1700000000 + 2592001 + 1},
+		{name: "60 days", d: 2 * maxRelativeExpiration, want: 1700000000 + 2*2592000 + 1},
+		{name: "past 2038", d: 20 * 365 * 24 * time.Hour, want: math.MaxInt32},
+		{name: "longest duration", d: math.MaxInt64, want: math.MaxInt32},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := expiration(tt.d, now); got != tt.want {
+				t.Errorf("expiration(%v) = %d, want %d", tt.d, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpirationAt(t *testing.T) {
+	t.Parallel()
+
+	if got := expirationAt(time.Unix(1700000000, 0)); got != 1700000000 {
+		t.Errorf("expirationAt() whole second = %d, want %d", got, 1700000000)
+	}
+	if got := expirationAt(time.Unix(1700000000, 1)); got != 1700000001 {
+		t.Errorf("expirationAt() fractional second = %d, want %d", got, 1700000001)
+	}
+	if got := expirationAt(time.Unix(math.MaxInt32, 0)); got != math.MaxInt32 {
+		t.Errorf("expirationAt() last 32-bit second = %d, want %d", got, math.MaxInt32)
+	}
+	if got := expirationAt(time.Unix(math.MaxInt32, 1)); got != math.MaxInt32 {
+		t.Errorf("expirationAt() past 32-bit range = %d, want %d", got, math.MaxInt32)
+	}
+}
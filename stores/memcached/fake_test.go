@@ -0,0 +1,99 @@
+package kvmemcached
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+// newFakeMemcached starts an in-process server speaking the subset of the memcached text
+// protocol used by the batch operations: gets, set, add and delete. Expirations are ignored.
+func newFakeMemcached(t *testing.T) *memcache.Client {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	var (
+		mu    sync.Mutex
+		items = make(map[string][]byte)
+		cas   uint64
+	)
+
+	serve := func(conn net.Conn) {
+		defer conn.Close()
+
+		rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+		for {
+			line, err := rw.ReadString('\n')
+			if err != nil {
+				return
+			}
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				return
+			}
+
+			mu.Lock()
+			switch fields[0] {
+			case "gets":
+				for _, key := range fields[1:] {
+					if value, ok := items[key]; ok {
+						cas++
+						fmt.Fprintf(rw, "VALUE %s 0 %d %d\r\n%s\r\n", key, len(value), cas, value)
+					}
+				}
+				rw.WriteString("END\r\n")
+			case "set", "add":
+				size, _ := strconv.Atoi(fields[4])
+				value := make([]byte, size+2)
+				if _, err := io.ReadFull(rw, value); err != nil {
+					mu.Unlock()
+					return
+				}
+				if _, exists := items[fields[1]]; exists && fields[0] == "add" {
+					rw.WriteString("NOT_STORED\r\n")
+					break
+				}
+				items[fields[1]] = value[:size]
+				rw.WriteString("STORED\r\n")
+			case "delete":
+				if _, ok := items[fields[1]]; ok {
+					delete(items, fields[1])
+					rw.WriteString("DELETED\r\n")
+				} else {
+					rw.WriteString("NOT_FOUND\r\n")
+				}
+			default:
+				rw.WriteString("ERROR\r\n")
+			}
+			mu.Unlock()
+
+			if err := rw.Flush(); err != nil {
+				return
+			}
+		}
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn)
+		}
+	}()
+
+	return memcache.New(ln.Addr().String())
+}
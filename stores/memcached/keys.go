@@ -0,0 +1,88 @@
+package kvmemcached
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/twirapp/kv/internal/keyseal"
+)
+
+// MaxKeyLength is the longest key memcached accepts, in bytes.
+const MaxKeyLength = 250
+
+// hashedKeySize is the length of the hash suffix SafeKey appends: a separator and
+// 128 bits of SHA-256 in hex.
+const hashedKeySize = 1 + 32
+
+// SafeKey returns key unchanged if memcached accepts it. Otherwise it returns a key made of
+// a readable prefix of key, with spaces and control characters replaced by underscores, and
+// a hash of the whole key, so the result is deterministic and at most MaxKeyLength bytes.
+// Keys containing the '#' hash separator are always hashed, so a hashed key is never the same
+// as a key returned unchanged.
+//
+// Use it with WithKeyTransformer, or with kvkeymap for other stores.
+func SafeKey(key string) string {
+	if validKey(key) && !strings.Contains(key, "#") {
+		return key
+	}
+
+	sum := sha256.Sum256([]byte(key))
+
+	prefix := key
+	if len(prefix) > MaxKeyLength-hashedKeySize {
+		prefix = prefix[:MaxKeyLength-hashedKeySize]
+	}
+	prefix = strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return '_'
+		}
+		return r
+	}, strings.ToValidUTF8(prefix, ""))
+
+	return prefix + "#" + hex.EncodeToString(sum[:16])
+}
+
+// validKey mirrors the key check of the memcache client.
+func validKey(key string) bool {
+	if len(key) > MaxKeyLength {
+		return false
+	}
+
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return false
+		}
+	}
+
+	return true
+}
+
+// storedKey returns the key key is stored under.
+func (c *KvMemcached) storedKey(key string) string {
+	if c.transformKey == nil {
+		return key
+	}
+
+	return c.transformKey(key)
+}
+
+// seal returns the value to write for key, sealed with key if it is stored under another key.
+func seal(key, stored string, value []byte) []byte {
+	if stored != key {
+		return keyseal.Seal(key, value)
+	}
+
+	return value
+}
+
+// open returns the value read for key, reporting kv.ErrKeyCollision if it was written for
+// another key transformed into the same stored key. The seal is checked even if key was not
+// transformed, since another key may have been transformed into key itself.
+func (c *KvMemcached) open(key string, data []byte) ([]byte, error) {
+	if c.transformKey == nil {
+		return data, nil
+	}
+
+	return keyseal.Check(key, data)
+}
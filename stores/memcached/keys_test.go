@@ -0,0 +1,94 @@
+package kvmemcached
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/twirapp/kv"
+)
+
+func TestSafeKey(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		key        string
+		unchanged  bool
+		wantPrefix string
+	}{
+		{name: "valid", key: "channel:1:commands:ping", unchanged: true},
+		{name: "max length", key: strings.Repeat("a", MaxKeyLength), unchanged: true},
+		{name: "space", key: "channel:1:commands:my command", wantPrefix: "channel:1:commands:my_command#"},
+		{name: "control characters", key: "key\n\t\x7f", wantPrefix: "key___#"},
+		{name: "hash separator", key: "channel:1#2", wantPrefix: "channel:1#2#"},
+		{name: "too long", key: strings.Repeat("a", MaxKeyLength+1), wantPrefix: strings.Repeat("a", MaxKeyLength-hashedKeySize) + "#"},
+		{name: "multibyte cut", key: strings.Repeat("a", MaxKeyLength-hashedKeySize-1) + strings.Repeat("ж", 20)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := SafeKey(tt.key)
+			if tt.unchanged {
+				if got != tt.key {
+					t.Errorf("SafeKey() = %q, want unchanged", got)
+				}
+				return
+			}
+
+			if got == tt.key {
+				t.Fatalf("SafeKey() = %q, want a transformed key", got)
+			}
+			if !validKey(got) {
+				t.Errorf("SafeKey() = %q, which memcached rejects", got)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("SafeKey() = %q, want valid UTF-8", got)
+			}
+			if !strings.HasPrefix(got, tt.wantPrefix) {
+				t.Errorf("SafeKey() = %q, want prefix %q", got, tt.wantPrefix)
+			}
+			if again := SafeKey(tt.key); again != got {
+				t.Errorf("SafeKey() = %q, then %q, want deterministic", got, again)
+			}
+			if SafeKey(got) == got {
+				t.Errorf("SafeKey() = %q, which is also a key SafeKey leaves unchanged", got)
+			}
+		})
+	}
+
+	if SafeKey("a b") == SafeKey("a\tb") {
+		t.Errorf("SafeKey() maps keys with the same readable prefix to the same key")
+	}
+}
+
+func TestKvMemcached_KeyCollision(t *testing.T) {
+	t.Parallel()
+
+	c := New(newFakeMemcached(t), WithKeyTransformer(func(key string) string {
+		if key == "a" {
+			return "b"
+		}
+		return key
+	}))
+	ctx := context.Background()
+
+	if err := c.Set(ctx, "a", "value"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if got, err := c.Get(ctx, "a").String(); err != nil || got != "value" {
+		t.Errorf("Get() own key got = %v, %v, want value", got, err)
+	}
+
+	// b is stored unchanged, under the same key a was transformed into.
+	if err := c.Get(ctx, "b").Err(); !errors.Is(err, kv.ErrKeyCollision) {
+		t.Errorf("Get() unchanged colliding key error = %v, want %v", err, kv.ErrKeyCollision)
+	}
+	if _, err := c.Exists(ctx, "b"); !errors.Is(err, kv.ErrKeyCollision) {
+		t.Errorf("Exists() unchanged colliding key error = %v, want %v", err, kv.ErrKeyCollision)
+	}
+}
@@ -4,35 +4,133 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"iter"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/bradfitz/gomemcache/memcache"
 	"github.com/twirapp/kv"
-	"github.com/twirapp/kv/internal/tobytes"
+	kvcodec "github.com/twirapp/kv/codec"
 	kvoptions "github.com/twirapp/kv/options"
 	kvvaluer "github.com/twirapp/kv/valuer"
 )
 
 var _ kv.KV = (*KvMemcached)(nil)
+var _ kv.CodecProvider = (*KvMemcached)(nil)
+
+// DefaultWorkers is the default number of keys written or deleted concurrently by SetMany and DeleteMany.
+const DefaultWorkers = 8
 
 type KvMemcached struct {
-	mc *memcache.Client
+	mc      *memcache.Client
+	codec   kvcodec.Codec
+	workers int
+
+	transformKey func(key string) string
+}
+
+type Option func(*KvMemcached)
+
+// WithWorkers sets the number of keys SetMany and DeleteMany process concurrently,
+// as memcached has no multi-key write commands. Defaults to DefaultWorkers.
+func WithWorkers(n int) Option {
+	return func(c *KvMemcached) {
+		c.workers = max(n, 1)
+	}
+}
+
+// WithCodec sets the codec used to encode values. Defaults to kvcodec.Default.
+func WithCodec(codec kvcodec.Codec) Option {
+	return func(c *KvMemcached) {
+		c.codec = codec
+	}
+}
+
+// WithKeyTransformer stores every key under fn(key), for example SafeKey to hash keys memcached
+// would reject. Values stored under a key fn changed are prefixed with the original key, so
+// reading a key stored under the same key as another one reports kv.ErrKeyCollision, whether
+// or not fn changed it.
+//
+// Counters are stored unprefixed, as memcached increments only plain numbers, so collisions
+// between transformed counter keys are not detected.
+func WithKeyTransformer(fn func(key string) string) Option {
+	return func(c *KvMemcached) {
+		c.transformKey = fn
+	}
 }
 
-func New(mc *memcache.Client) *KvMemcached {
-	return &KvMemcached{
-		mc: mc,
+func New(mc *memcache.Client, options ...Option) *KvMemcached {
+	c := &KvMemcached{
+		mc:      mc,
+		codec:   kvcodec.Default,
+		workers: DefaultWorkers,
 	}
+
+	for _, o := range options {
+		o(c)
+	}
+
+	return c
+}
+
+// Codec returns the codec used to encode values.
+func (c *KvMemcached) Codec() kvcodec.Codec {
+	return c.codec
 }
 
 func (c *KvMemcached) Get(_ context.Context, key string) kv.Valuer {
-	item, err := c.mc.Get(key)
+	stored := c.storedKey(key)
+
+	item, err := c.mc.Get(stored)
 	if err != nil {
 		if errors.Is(err, memcache.ErrCacheMiss) {
 			return &kvvaluer.Valuer{Error: kv.ErrKeyNil}
 		}
 		return &kvvaluer.Valuer{Error: err}
 	}
-	return &kvvaluer.Valuer{Value: item.Value}
+
+	value, err := c.open(key, item.Value)
+	if err != nil {
+		return &kvvaluer.Valuer{Error: err}
+	}
+
+	return &kvvaluer.Valuer{Value: value}
+}
+
+func (c *KvMemcached) GetMany(_ context.Context, keys []string) []kv.Valuer {
+	results := make([]kv.Valuer, len(keys))
+	if len(keys) == 0 {
+		return results
+	}
+
+	storedKeys := c.storedKeys(keys)
+
+	items, err := c.mc.GetMulti(storedKeys)
+	if err != nil {
+		for i := range results {
+			results[i] = &kvvaluer.Valuer{Error: err}
+		}
+		return results
+	}
+
+	for i, key := range keys {
+		item, ok := items[storedKeys[i]]
+		if !ok {
+			results[i] = &kvvaluer.Valuer{Error: kv.ErrKeyNil}
+			continue
+		}
+
+		value, err := c.open(key, item.Value)
+		if err != nil {
+			results[i] = &kvvaluer.Valuer{Error: err}
+			continue
+		}
+
+		results[i] = &kvvaluer.Valuer{Value: value}
+	}
+
+	return results
 }
 
 func (c *KvMemcached) Set(
@@ -42,70 +140,316 @@ func (c *KvMemcached) Set(
 	options ...kvoptions.Option,
 ) error {
 	o := kvoptions.Construct(options...)
-	valueBytes, err := tobytes.ToBytes(value)
+	valueBytes, err := c.codec.Marshal(value)
 	if err != nil {
 		return fmt.Errorf("failed to convert value to bytes: %w", err)
 	}
+	stored := c.storedKey(key)
 	item := &memcache.Item{
-		Key:   key,
-		Value: valueBytes,
+		Key:   stored,
+		Value: seal(key, stored, valueBytes),
 	}
 	if o.Expire > 0 {
-		item.Expiration = int32(o.Expire.Seconds())
+		item.Expiration = expiration(o.Expire, time.Now())
+	}
+
+	switch {
+	case o.OnlyIfNotExists:
+		err = c.mc.Add(item)
+	case o.OnlyIfExists:
+		err = c.mc.Replace(item)
+	default:
+		err = c.mc.Set(item)
 	}
-	err = c.mc.Set(item)
+	if errors.Is(err, memcache.ErrNotStored) {
+		return kv.ErrNotSet
+	}
+
 	return err
 }
 
+// SetMany writes the values concurrently. It attempts every value and returns the errors
+// of all failed keys joined together.
 func (c *KvMemcached) SetMany(ctx context.Context, values []kv.SetMany) error {
-	for _, v := range values {
-		if err := c.Set(ctx, v.Key, v.Value, v.Options...); err != nil {
-			return err
+	return c.forEach(len(values), func(i int) error {
+		if err := c.Set(ctx, values[i].Key, values[i].Value, values[i].Options...); err != nil {
+			return fmt.Errorf("failed to set key %s: %w", values[i].Key, err)
 		}
+		return nil
+	})
+}
+
+// forEach calls fn for the indexes 0 to n-1 using up to c.workers goroutines
+// and joins the returned errors in index order.
+func (c *KvMemcached) forEach(n int, fn func(i int) error) error {
+	var (
+		errs = make([]error, n)
+		sem  = make(chan struct{}, c.workers)
+		wg   sync.WaitGroup
+	)
+
+	for i := range n {
+		sem <- struct{}{}
+		wg.Add(1)
+
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			errs[i] = fn(i)
+		}()
 	}
-	return nil
+
+	wg.Wait()
+
+	return errors.Join(errs...)
 }
 
 func (c *KvMemcached) Delete(_ context.Context, key string) error {
-	err := c.mc.Delete(key)
+	err := c.mc.Delete(c.storedKey(key))
 	if err != nil && !errors.Is(err, memcache.ErrCacheMiss) {
 		return err
 	}
 	return nil
 }
 
+// DeleteMany deletes the keys concurrently. It attempts every key and returns the errors
+// of all failed keys joined together.
 func (c *KvMemcached) DeleteMany(ctx context.Context, keys []string) error {
-	for _, key := range keys {
-		if err := c.Delete(ctx, key); err != nil {
-			return err
+	return c.forEach(len(keys), func(i int) error {
+		if err := c.Delete(ctx, keys[i]); err != nil {
+			return fmt.Errorf("failed to delete key %s: %w", keys[i], err)
 		}
-	}
-	return nil
+		return nil
+	})
 }
 
 func (c *KvMemcached) Exists(_ context.Context, key string) (bool, error) {
-	_, err := c.mc.Get(key)
+	stored := c.storedKey(key)
+
+	item, err := c.mc.Get(stored)
 	if err != nil {
 		if errors.Is(err, memcache.ErrCacheMiss) {
 			return false, nil
 		}
 		return false, err
 	}
+
+	if _, err := c.open(key, item.Value); err != nil {
+		return false, err
+	}
+
 	return true, nil
 }
 
-func (c *KvMemcached) ExistsMany(ctx context.Context, keys []string) ([]bool, error) {
+// ExistsMany fetches all keys in one GetMulti, as memcached has no command checking
+// existence without reading the value.
+func (c *KvMemcached) ExistsMany(_ context.Context, keys []string) ([]bool, error) {
 	results := make([]bool, len(keys))
+	if len(keys) == 0 {
+		return results, nil
+	}
+
+	storedKeys := c.storedKeys(keys)
+
+	items, err := c.mc.GetMulti(storedKeys)
+	if err != nil {
+		return nil, fmt.Errorf("error checking existence of keys: %w", err)
+	}
+
 	for i, key := range keys {
-		exists, err := c.Exists(ctx, key)
-		if err != nil {
-			return nil, fmt.Errorf("error checking existence for key %s: %w", key, err)
+		item, ok := items[storedKeys[i]]
+		if !ok {
+			continue
+		}
+
+		if _, err := c.open(key, item.Value); err != nil {
+			return nil, err
 		}
-		results[i] = exists
+		results[i] = true
 	}
+
 	return results, nil
 }
 
+// storedKeys returns the keys keys are stored under.
+func (c *KvMemcached) storedKeys(keys []string) []string {
+	if c.transformKey == nil {
+		return keys
+	}
+
+	stored := make([]string, len(keys))
+	for i, key := range keys {
+		stored[i] = c.transformKey(key)
+	}
+
+	return stored
+}
+
 func (c *KvMemcached) GetKeysByPattern(ctx context.Context, pattern string) ([]string, error) {
-	return nil, fmt.Errorf("GetKeysByPattern is not supported in Memcached")
+	return nil, fmt.Errorf("GetKeysByPattern is not supported in Memcached: %w", kv.ErrNotSupported)
+}
+
+func (c *KvMemcached) ScanKeys(_ context.Context, _ string) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		yield("", fmt.Errorf("ScanKeys is not supported in Memcached: %w", kv.ErrNotSupported))
+	}
+}
+
+func (c *KvMemcached) DeleteByPattern(_ context.Context, _ string) (int64, error) {
+	return 0, fmt.Errorf("DeleteByPattern is not supported in Memcached: %w", kv.ErrNotSupported)
+}
+
+func (c *KvMemcached) Incr(ctx context.Context, key string, options ...kvoptions.Option) (int64, error) {
+	return c.IncrBy(ctx, key, 1, options...)
+}
+
+// IncrBy increments the counter stored at key by delta. Memcached counters are unsigned 64-bit
+// integers, so decrementing below zero leaves the counter at 0.
+func (c *KvMemcached) IncrBy(_ context.Context, key string, delta int64, options ...kvoptions.Option) (int64, error) {
+	o := kvoptions.Construct(options...)
+	key = c.storedKey(key)
+
+	for {
+		var (
+			value uint64
+			err   error
+		)
+		if delta >= 0 {
+			value, err = c.mc.Increment(key, uint64(delta))
+		} else {
+			value, err = c.mc.Decrement(key, uint64(-delta))
+		}
+		if err == nil {
+			return int64(value), nil
+		}
+		if !errors.Is(err, memcache.ErrCacheMiss) {
+			return 0, err
+		}
+
+		initial := max(delta, 0)
+		item := &memcache.Item{
+			Key:   key,
+			Value: []byte(strconv.FormatInt(initial, 10)),
+		}
+		if o.Expire > 0 {
+			item.Expiration = expiration(o.Expire, time.Now())
+		}
+
+		err = c.mc.Add(item)
+		if err == nil {
+			return initial, nil
+		}
+		if !errors.Is(err, memcache.ErrNotStored) {
+			return 0, err
+		}
+		// The counter was created concurrently by another client, retry the increment.
+	}
+}
+
+func (c *KvMemcached) IncrByFloat(_ context.Context, _ string, _ float64, _ ...kvoptions.Option) (float64, error) {
+	return 0, fmt.Errorf("IncrByFloat is not supported in Memcached: %w", kv.ErrNotSupported)
+}
+
+func (c *KvMemcached) Decr(ctx context.Context, key string, options ...kvoptions.Option) (int64, error) {
+	return c.IncrBy(ctx, key, -1, options...)
+}
+
+func (c *KvMemcached) TTL(_ context.Context, _ string) (time.Duration, error) {
+	return 0, fmt.Errorf("TTL is not supported in Memcached: %w", kv.ErrNotSupported)
+}
+
+func (c *KvMemcached) Expire(ctx context.Context, key string, d time.Duration) error {
+	if d <= 0 {
+		return c.expireNow(ctx, key)
+	}
+
+	return c.touch(key, expiration(d, time.Now()))
+}
+
+func (c *KvMemcached) ExpireAt(ctx context.Context, key string, t time.Time) error {
+	if !t.After(time.Now()) {
+		return c.expireNow(ctx, key)
+	}
+
+	return c.touch(key, expirationAt(t))
+}
+
+func (c *KvMemcached) Persist(_ context.Context, key string) error {
+	return c.touch(key, 0)
+}
+
+func (c *KvMemcached) touch(key string, expiration int32) error {
+	err := c.mc.Touch(c.storedKey(key), expiration)
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return kv.ErrKeyNil
+	}
+
+	return err
+}
+
+// expireNow deletes key, reporting ErrKeyNil if it did not exist.
+// Memcached treats a zero expiration as "never expire", so it cannot be used to expire a key immediately.
+func (c *KvMemcached) expireNow(_ context.Context, key string) error {
+	err := c.mc.Delete(c.storedKey(key))
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return kv.ErrKeyNil
+	}
+
+	return err
+}
+
+func (c *KvMemcached) GetWithVersion(_ context.Context, key string) (kv.Valuer, kv.Version) {
+	stored := c.storedKey(key)
+
+	item, err := c.mc.Get(stored)
+	if err != nil {
+		if errors.Is(err, memcache.ErrCacheMiss) {
+			return &kvvaluer.Valuer{Error: kv.ErrKeyNil}, ""
+		}
+		return &kvvaluer.Valuer{Error: err}, ""
+	}
+
+	value, err := c.open(key, item.Value)
+	if err != nil {
+		return &kvvaluer.Valuer{Error: err}, ""
+	}
+
+	return &kvvaluer.Valuer{Value: value}, kv.Version(strconv.FormatUint(item.CasID, 10))
+}
+
+func (c *KvMemcached) CompareAndSwap(
+	_ context.Context,
+	key string,
+	version kv.Version,
+	value any,
+	options ...kvoptions.Option,
+) error {
+	casID, err := strconv.ParseUint(string(version), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid version %q: %w", version, kv.ErrVersionMismatch)
+	}
+
+	o := kvoptions.Construct(options...)
+	valueBytes, err := c.codec.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to convert value to bytes: %w", err)
+	}
+	stored := c.storedKey(key)
+	item := &memcache.Item{
+		Key:   stored,
+		Value: seal(key, stored, valueBytes),
+		CasID: casID,
+	}
+	if o.Expire > 0 {
+		item.Expiration = expiration(o.Expire, time.Now())
+	}
+
+	err = c.mc.CompareAndSwap(item)
+	if errors.Is(err, memcache.ErrCASConflict) || errors.Is(err, memcache.ErrCacheMiss) {
+		return kv.ErrVersionMismatch
+	}
+
+	return err
 }
@@ -0,0 +1,138 @@
+package kvmemcached
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/twirapp/kv"
+	kvoptions "github.com/twirapp/kv/options"
+)
+
+func TestKvMemcached_ForEach(t *testing.T) {
+	t.Parallel()
+
+	c := New(nil, WithWorkers(3))
+
+	var (
+		calls, running, peak atomic.Int32
+		errOdd               = errors.New("odd index")
+	)
+	err := c.forEach(20, func(i int) error {
+		calls.Add(1)
+
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+
+		if i%2 == 1 {
+			return errOdd
+		}
+		return nil
+	})
+
+	if got := calls.Load(); got != 20 {
+		t.Errorf("forEach() calls = %d, want 20", got)
+	}
+	if got := peak.Load(); got > 3 {
+		t.Errorf("forEach() concurrency = %d, want at most 3", got)
+	}
+	if !errors.Is(err, errOdd) {
+		t.Errorf("forEach() error = %v, want %v", err, errOdd)
+	}
+	if got := len(err.(interface{ Unwrap() []error }).Unwrap()); got != 10 {
+		t.Errorf("forEach() joined errors = %d, want 10", got)
+	}
+}
+
+func TestKvMemcached_SetManyPartialFailure(t *testing.T) {
+	t.Parallel()
+
+	c := New(newFakeMemcached(t), WithWorkers(2))
+	ctx := context.Background()
+
+	if err := c.Set(ctx, "b", "old"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	err := c.SetMany(ctx, []kv.SetMany{
+		{Key: "a", Value: "value-a"},
+		{Key: "b", Value: "new", Options: []kvoptions.Option{kvoptions.WithOnlyIfNotExists()}},
+		{Key: "c", Value: "value-c"},
+	})
+	if !errors.Is(err, kv.ErrNotSet) {
+		t.Fatalf("SetMany() error = %v, want %v", err, kv.ErrNotSet)
+	}
+
+	for key, want := range map[string]string{"a": "value-a", "b": "old", "c": "value-c"} {
+		if got, err := c.Get(ctx, key).String(); err != nil || got != want {
+			t.Errorf("Get(%q) got = %v, %v, want %v", key, got, err, want)
+		}
+	}
+}
+
+func TestKvMemcached_DeleteManyPartialFailure(t *testing.T) {
+	t.Parallel()
+
+	c := New(newFakeMemcached(t), WithWorkers(2))
+	ctx := context.Background()
+
+	for _, key := range []string{"a", "c"} {
+		if err := c.Set(ctx, key, "value"); err != nil {
+			t.Fatalf("Set(%q) error = %v", key, err)
+		}
+	}
+
+	// Missing keys are not an error, malformed ones are reported without stopping the others.
+	err := c.DeleteMany(ctx, []string{"a", "bad key", "missing", "c"})
+	if !errors.Is(err, memcache.ErrMalformedKey) {
+		t.Fatalf("DeleteMany() error = %v, want %v", err, memcache.ErrMalformedKey)
+	}
+	if errors.Is(err, kv.ErrKeyNil) {
+		t.Errorf("DeleteMany() error = %v, want missing keys ignored", err)
+	}
+
+	for _, key := range []string{"a", "c"} {
+		if err := c.Get(ctx, key).Err(); !errors.Is(err, kv.ErrKeyNil) {
+			t.Errorf("Get(%q) after DeleteMany() error = %v, want %v", key, err, kv.ErrKeyNil)
+		}
+	}
+}
+
+func TestKvMemcached_ExistsMany(t *testing.T) {
+	t.Parallel()
+
+	c := New(newFakeMemcached(t))
+	ctx := context.Background()
+
+	for _, key := range []string{"a", "c"} {
+		if err := c.Set(ctx, key, "value"); err != nil {
+			t.Fatalf("Set(%q) error = %v", key, err)
+		}
+	}
+
+	got, err := c.ExistsMany(ctx, []string{"a", "b", "c", "d"})
+	if err != nil {
+		t.Fatalf("ExistsMany() error = %v", err)
+	}
+
+	want := []bool{true, false, true, false}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("ExistsMany()[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+
+	if got, err := c.ExistsMany(ctx, nil); err != nil || len(got) != 0 {
+		t.Errorf("ExistsMany() empty got = %v, %v, want empty", got, err)
+	}
+}
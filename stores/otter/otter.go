@@ -2,27 +2,87 @@ package kvotter
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"strings"
+	"iter"
+	"math"
+	"strconv"
+	"time"
 
 	"github.com/maypok86/otter/v2"
 	"github.com/twirapp/kv"
+	kvcodec "github.com/twirapp/kv/codec"
 	"github.com/twirapp/kv/internal/matchpattern"
-	"github.com/twirapp/kv/internal/tobytes"
+	"github.com/twirapp/kv/internal/valueversion"
 	kvoptions "github.com/twirapp/kv/options"
 	kvvaluer "github.com/twirapp/kv/valuer"
 )
 
 var _ kv.KV = (*Otter)(nil)
+var _ kv.CodecProvider = (*Otter)(nil)
+var _ kv.TTLManyProvider = (*Otter)(nil)
 
-func New() *Otter {
-	cache := otter.Must(&otter.Options[string, []byte]{})
+type otterValue struct {
+	value []byte
+	// expiresAt is the absolute deadline of the value in unix nanoseconds. Zero means the value never expires.
+	expiresAt int64
+	// version changes on every write of the value.
+	version uint64
+}
+
+func newOtterValue(value []byte, expire time.Duration) otterValue {
+	v := otterValue{value: value, version: valueversion.Next()}
+	if expire > 0 {
+		v.expiresAt = time.Now().Add(expire).UnixNano()
+	}
+
+	return v
+}
+
+// expireAfter derives the otter lifetime of an entry from the deadline stored in its value,
+// so every write decides the expiration of the key, like SET does in Redis.
+func expireAfter(entry otter.Entry[string, otterValue]) time.Duration {
+	if entry.Value.expiresAt == 0 {
+		return time.Duration(math.MaxInt64 - entry.SnapshotAtNano)
+	}
+
+	return max(time.Duration(entry.Value.expiresAt-entry.SnapshotAtNano), 1)
+}
+
+type Option func(*Otter)
+
+// WithCodec sets the codec used to encode values. Defaults to kvcodec.Default.
+func WithCodec(codec kvcodec.Codec) Option {
+	return func(c *Otter) {
+		c.codec = codec
+	}
+}
+
+func New(options ...Option) *Otter {
+	cache := otter.Must(&otter.Options[string, otterValue]{
+		ExpiryCalculator: otter.ExpiryWritingFunc(expireAfter),
+	})
+
+	c := &Otter{
+		o:     cache,
+		codec: kvcodec.Default,
+	}
 
-	return &Otter{o: cache}
+	for _, o := range options {
+		o(c)
+	}
+
+	return c
+}
+
+// Codec returns the codec used to encode values.
+func (c *Otter) Codec() kvcodec.Codec {
+	return c.codec
 }
 
 type Otter struct {
-	o *otter.Cache[string, []byte]
+	o     *otter.Cache[string, otterValue]
+	codec kvcodec.Codec
 }
 
 func (c *Otter) Get(_ context.Context, key string) kv.Valuer {
@@ -31,36 +91,68 @@ func (c *Otter) Get(_ context.Context, key string) kv.Valuer {
 		return &kvvaluer.Valuer{Error: kv.ErrKeyNil}
 	}
 
-	return &kvvaluer.Valuer{Value: v}
+	return &kvvaluer.Valuer{Value: v.value}
+}
+
+func (c *Otter) GetMany(_ context.Context, keys []string) []kv.Valuer {
+	results := make([]kv.Valuer, len(keys))
+	for i, key := range keys {
+		v, ok := c.o.GetIfPresent(key)
+		if !ok {
+			results[i] = &kvvaluer.Valuer{Error: kv.ErrKeyNil}
+			continue
+		}
+
+		results[i] = &kvvaluer.Valuer{Value: v.value}
+	}
+
+	return results
 }
 
 func (c *Otter) Set(_ context.Context, key string, value any, options ...kvoptions.Option) error {
-	b, err := tobytes.ToBytes(value)
+	b, err := c.codec.Marshal(value)
 	if err != nil {
 		return err
 	}
 
-	v, ok := c.o.Set(key, b)
-	if !ok && v == nil {
-		return fmt.Errorf("failed to set value for key %s", key)
+	o := kvoptions.Construct(options...)
+
+	if o.OnlyIfNotExists || o.OnlyIfExists {
+		written := false
+		c.o.Compute(key, func(old otterValue, found bool) (otterValue, otter.ComputeOp) {
+			if found == o.OnlyIfNotExists {
+				return old, otter.CancelOp
+			}
+
+			written = true
+			return newOtterValue(b, o.Expire), otter.WriteOp
+		})
+		if !written {
+			return kv.ErrNotSet
+		}
+
+		return nil
 	}
 
-	o := kvoptions.Construct(options...)
-	if o.Expire > 0 {
-		c.o.SetExpiresAfter(key, o.Expire)
+	v, ok := c.o.Set(key, newOtterValue(b, o.Expire))
+	if !ok && v.value == nil {
+		return fmt.Errorf("failed to set value for key %s", key)
 	}
 
 	return nil
 }
 
+// SetMany attempts every value and returns the errors of all failed keys joined together.
 func (c *Otter) SetMany(ctx context.Context, values []kv.SetMany) error {
+	var errs []error
+
 	for _, v := range values {
 		if err := c.Set(ctx, v.Key, v.Value, v.Options...); err != nil {
-			return err
+			errs = append(errs, fmt.Errorf("failed to set key %s: %w", v.Key, err))
 		}
 	}
 
-	return nil
+	return errors.Join(errs...)
 }
 
 func (c *Otter) Delete(_ context.Context, key string) error {
@@ -94,18 +186,221 @@ func (c *Otter) ExistsMany(_ context.Context, keys []string) ([]bool, error) {
 	return results, nil
 }
 
-func (c *Otter) GetKeysByPattern(_ context.Context, pattern string) ([]string, error) {
+func (c *Otter) GetKeysByPattern(ctx context.Context, pattern string) ([]string, error) {
+	var keys []string
+
+	for key, err := range c.ScanKeys(ctx, pattern) {
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+func (c *Otter) ScanKeys(ctx context.Context, pattern string) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		for key := range c.o.Keys() {
+			if err := ctx.Err(); err != nil {
+				yield("", err)
+				return
+			}
+
+			if !matchpattern.MatchPattern(pattern, key) {
+				continue
+			}
+			if !yield(key, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (c *Otter) DeleteByPattern(_ context.Context, pattern string) (int64, error) {
+	var deleted int64
+
+	for key := range c.o.Keys() {
+		if !matchpattern.MatchPattern(pattern, key) {
+			continue
+		}
+
+		if _, invalidated := c.o.Invalidate(key); invalidated {
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+func (c *Otter) Incr(ctx context.Context, key string, options ...kvoptions.Option) (int64, error) {
+	return c.IncrBy(ctx, key, 1, options...)
+}
+
+func (c *Otter) IncrBy(_ context.Context, key string, delta int64, options ...kvoptions.Option) (int64, error) {
 	var (
-		keys         []string
-		patternParts = strings.Split(pattern, ":")
+		result int64
+		err    error
 	)
 
-	for key := range c.o.Keys() {
-		keyParts := strings.Split(key, ":")
-		if matchpattern.MatchPattern(patternParts, keyParts) {
-			keys = append(keys, key)
+	c.o.Compute(key, func(old otterValue, found bool) (otterValue, otter.ComputeOp) {
+		v := old
+		if !found {
+			v = newOtterValue(nil, kvoptions.Construct(options...).Expire)
+		} else {
+			result, err = strconv.ParseInt(string(old.value), 10, 64)
+			if err != nil {
+				err = fmt.Errorf("value of key %s is not an integer: %w", key, kv.ErrInvalidType)
+				return old, otter.CancelOp
+			}
+		}
+
+		result += delta
+		v.value = []byte(strconv.FormatInt(result, 10))
+		v.version = valueversion.Next()
+
+		return v, otter.WriteOp
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return result, nil
+}
+
+func (c *Otter) IncrByFloat(_ context.Context, key string, delta float64, options ...kvoptions.Option) (float64, error) {
+	var (
+		result float64
+		err    error
+	)
+
+	c.o.Compute(key, func(old otterValue, found bool) (otterValue, otter.ComputeOp) {
+		v := old
+		if !found {
+			v = newOtterValue(nil, kvoptions.Construct(options...).Expire)
+		} else {
+			result, err = strconv.ParseFloat(string(old.value), 64)
+			if err != nil {
+				err = fmt.Errorf("value of key %s is not a float: %w", key, kv.ErrInvalidType)
+				return old, otter.CancelOp
+			}
 		}
+
+		result += delta
+		v.value = []byte(strconv.FormatFloat(result, 'f', -1, 64))
+		v.version = valueversion.Next()
+
+		return v, otter.WriteOp
+	})
+	if err != nil {
+		return 0, err
 	}
 
-	return keys, nil
+	return result, nil
+}
+
+func (c *Otter) Decr(ctx context.Context, key string, options ...kvoptions.Option) (int64, error) {
+	return c.IncrBy(ctx, key, -1, options...)
+}
+
+func (c *Otter) TTL(_ context.Context, key string) (time.Duration, error) {
+	v, ok := c.o.GetIfPresent(key)
+	if !ok {
+		return 0, kv.ErrKeyNil
+	}
+
+	if v.expiresAt == 0 {
+		return kv.NoExpiration, nil
+	}
+
+	return time.Until(time.Unix(0, v.expiresAt)), nil
+}
+
+func (c *Otter) TTLMany(ctx context.Context, keys []string) ([]time.Duration, error) {
+	results := make([]time.Duration, len(keys))
+	for i, key := range keys {
+		ttl, err := c.TTL(ctx, key)
+		if err != nil && !errors.Is(err, kv.ErrKeyNil) {
+			return nil, err
+		}
+		results[i] = ttl
+	}
+
+	return results, nil
+}
+
+func (c *Otter) Expire(_ context.Context, key string, d time.Duration) error {
+	return c.setExpiresAt(key, time.Now().Add(d))
+}
+
+func (c *Otter) ExpireAt(_ context.Context, key string, t time.Time) error {
+	return c.setExpiresAt(key, t)
+}
+
+func (c *Otter) Persist(_ context.Context, key string) error {
+	return c.setExpiresAt(key, time.Time{})
+}
+
+// setExpiresAt changes the deadline of an existing key. A zero t removes the expiration,
+// a t in the past deletes the key.
+func (c *Otter) setExpiresAt(key string, t time.Time) error {
+	found := false
+	c.o.ComputeIfPresent(key, func(old otterValue) (otterValue, otter.ComputeOp) {
+		found = true
+
+		if t.IsZero() {
+			old.expiresAt = 0
+			return old, otter.WriteOp
+		}
+		if !time.Now().Before(t) {
+			return old, otter.InvalidateOp
+		}
+
+		old.expiresAt = t.UnixNano()
+		return old, otter.WriteOp
+	})
+	if !found {
+		return kv.ErrKeyNil
+	}
+
+	return nil
+}
+
+func (c *Otter) GetWithVersion(_ context.Context, key string) (kv.Valuer, kv.Version) {
+	v, ok := c.o.GetIfPresent(key)
+	if !ok {
+		return &kvvaluer.Valuer{Error: kv.ErrKeyNil}, ""
+	}
+
+	return &kvvaluer.Valuer{Value: v.value}, kv.Version(strconv.FormatUint(v.version, 10))
+}
+
+func (c *Otter) CompareAndSwap(
+	_ context.Context,
+	key string,
+	version kv.Version,
+	value any,
+	options ...kvoptions.Option,
+) error {
+	b, err := c.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	o := kvoptions.Construct(options...)
+
+	swapped := false
+	c.o.ComputeIfPresent(key, func(old otterValue) (otterValue, otter.ComputeOp) {
+		if kv.Version(strconv.FormatUint(old.version, 10)) != version {
+			return old, otter.CancelOp
+		}
+
+		swapped = true
+		return newOtterValue(b, o.Expire), otter.WriteOp
+	})
+	if !swapped {
+		return kv.ErrVersionMismatch
+	}
+
+	return nil
 }
@@ -0,0 +1,79 @@
+package kvredis
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	kvbus "github.com/twirapp/kv/bus"
+	"github.com/twirapp/kv/internal/backoff"
+)
+
+var _ kvbus.Bus = (*InvalidationBus)(nil)
+
+// InvalidationBus is a kvbus.Bus over Redis pub/sub.
+//
+// go-redis reconnects and resubscribes on its own after a connection failure. Messages
+// published while disconnected are lost, so subscribers receive kvbus.InvalidateAll
+// after every resubscription.
+type InvalidationBus struct {
+	r       redis.UniversalClient
+	channel string
+}
+
+func NewInvalidationBus(r redis.UniversalClient, channel string) *InvalidationBus {
+	return &InvalidationBus{
+		r:       r,
+		channel: channel,
+	}
+}
+
+func (b *InvalidationBus) Publish(ctx context.Context, msg kvbus.Invalidation) error {
+	return b.r.Publish(ctx, b.channel, msg).Err()
+}
+
+func (b *InvalidationBus) Subscribe(handler func(kvbus.Invalidation)) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	ps := b.r.Subscribe(ctx, b.channel)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		retry := backoff.Backoff{Min: 100 * time.Millisecond, Max: 5 * time.Second}
+		subscribed := false
+
+		for {
+			msg, err := ps.Receive(ctx)
+			if err != nil {
+				if ctx.Err() != nil || !retry.Wait(ctx) {
+					return
+				}
+				continue
+			}
+			retry.Reset()
+
+			switch m := msg.(type) {
+			case *redis.Subscription:
+				if m.Kind != "subscribe" {
+					continue
+				}
+				if subscribed {
+					handler(kvbus.InvalidateAll())
+				}
+				subscribed = true
+			case *redis.Message:
+				var inv kvbus.Invalidation
+				if err := inv.UnmarshalBinary([]byte(m.Payload)); err == nil {
+					handler(inv)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		_ = ps.Close()
+		<-done
+	}
+}
@@ -4,25 +4,131 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"iter"
+	"sync"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 	kv "github.com/twirapp/kv"
+	kvcodec "github.com/twirapp/kv/codec"
+	"github.com/twirapp/kv/internal/hashslot"
+	"github.com/twirapp/kv/internal/valueversion"
 	kvoptions "github.com/twirapp/kv/options"
 	kvvaluer "github.com/twirapp/kv/valuer"
 )
 
 var _ kv.KV = (*KvRedis)(nil)
+var _ kv.CodecProvider = (*KvRedis)(nil)
+var _ kv.TTLManyProvider = (*KvRedis)(nil)
 
 type KvRedis struct {
-	r *redis.Client
+	r         redis.UniversalClient
+	scanCount int64
+	codec     kvcodec.Codec
 }
 
-func New(r *redis.Client) *KvRedis {
-	return &KvRedis{
-		r: r,
+type Option func(*KvRedis)
+
+// WithCodec sets the codec used to encode values. Defaults to kvcodec.Default.
+func WithCodec(codec kvcodec.Codec) Option {
+	return func(c *KvRedis) {
+		c.codec = codec
+	}
+}
+
+// WithScanCount sets the COUNT hint used for every SCAN page. Zero leaves the server default.
+func WithScanCount(count int64) Option {
+	return func(c *KvRedis) {
+		c.scanCount = count
+	}
+}
+
+// New creates a store over any go-redis client: a standalone or Sentinel-managed *redis.Client,
+// a *redis.ClusterClient or a *redis.Ring. Multi-key operations are split so that every command
+// addresses a single hash slot on a cluster and a single key on a ring, and key scans visit every
+// master or shard.
+func New(r redis.UniversalClient, options ...Option) *KvRedis {
+	c := &KvRedis{
+		r:     r,
+		codec: kvcodec.Default,
+	}
+
+	for _, o := range options {
+		o(c)
+	}
+
+	return c
+}
+
+// Codec returns the codec used to encode values.
+func (c *KvRedis) Codec() kvcodec.Codec {
+	return c.codec
+}
+
+// keyGroups splits the indexes of keys into groups that a single multi-key command can address:
+// one group on a standalone client, one per hash slot on a cluster and one per key on a ring,
+// whose sharding does not follow hash slots.
+func (c *KvRedis) keyGroups(keys []string) [][]int {
+	switch c.r.(type) {
+	case *redis.ClusterClient:
+		return hashslot.Group(keys)
+	case *redis.Ring:
+		groups := make([][]int, len(keys))
+		for i := range keys {
+			groups[i] = []int{i}
+		}
+		return groups
+	default:
+		group := make([]int, len(keys))
+		for i := range keys {
+			group[i] = i
+		}
+		return [][]int{group}
 	}
 }
 
+// pick returns the keys at the given indexes.
+func pick(keys []string, indexes []int) []string {
+	picked := make([]string, len(indexes))
+	for i, idx := range indexes {
+		picked[i] = keys[idx]
+	}
+
+	return picked
+}
+
+// nodes returns the clients to run key scans on: every master of a cluster, every shard of
+// a ring, or the client itself.
+func (c *KvRedis) nodes(ctx context.Context) ([]redis.Cmdable, error) {
+	var (
+		mu    sync.Mutex
+		nodes []redis.Cmdable
+	)
+
+	collect := func(_ context.Context, node *redis.Client) error {
+		mu.Lock()
+		nodes = append(nodes, node)
+		mu.Unlock()
+
+		return nil
+	}
+
+	switch r := c.r.(type) {
+	case *redis.ClusterClient:
+		if err := r.ForEachMaster(ctx, collect); err != nil {
+			return nil, err
+		}
+	case *redis.Ring:
+		if err := r.ForEachShard(ctx, collect); err != nil {
+			return nil, err
+		}
+	default:
+		nodes = append(nodes, c.r)
+	}
+
+	return nodes, nil
+}
+
 func (c *KvRedis) Get(ctx context.Context, key string) kv.Valuer {
 	result, err := c.r.Get(ctx, key).Bytes()
 	if err != nil {
@@ -35,6 +141,46 @@ func (c *KvRedis) Get(ctx context.Context, key string) kv.Valuer {
 	return &kvvaluer.Valuer{Value: result}
 }
 
+func (c *KvRedis) GetMany(ctx context.Context, keys []string) []kv.Valuer {
+	results := make([]kv.Valuer, len(keys))
+	if len(keys) == 0 {
+		return results
+	}
+
+	groups := c.keyGroups(keys)
+	cmds := make([]*redis.SliceCmd, len(groups))
+
+	_, err := c.r.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, group := range groups {
+			cmds[i] = pipe.MGet(ctx, pick(keys, group)...)
+		}
+		return nil
+	})
+	if err != nil {
+		for i := range results {
+			results[i] = &kvvaluer.Valuer{Error: err}
+		}
+		return results
+	}
+
+	for g, group := range groups {
+		for i, v := range cmds[g].Val() {
+			idx := group[i]
+
+			switch v := v.(type) {
+			case nil:
+				results[idx] = &kvvaluer.Valuer{Error: kv.ErrKeyNil}
+			case string:
+				results[idx] = &kvvaluer.Valuer{Value: []byte(v)}
+			default:
+				results[idx] = &kvvaluer.Valuer{Error: fmt.Errorf("unexpected type %T for key %s", v, keys[idx])}
+			}
+		}
+	}
+
+	return results
+}
+
 func (c *KvRedis) Set(
 	ctx context.Context,
 	key string,
@@ -43,21 +189,62 @@ func (c *KvRedis) Set(
 ) error {
 	o := kvoptions.Construct(options...)
 
-	return c.r.Set(ctx, key, value, o.Expire).Err()
+	b, err := c.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	err = c.r.SetArgs(ctx, key, b, setArgs(o)).Err()
+	if errors.Is(err, redis.Nil) {
+		return kv.ErrNotSet
+	}
+
+	return err
 }
 
+func setArgs(o kvoptions.Options) redis.SetArgs {
+	args := redis.SetArgs{TTL: o.Expire}
+	switch {
+	case o.OnlyIfNotExists:
+		args.Mode = "NX"
+	case o.OnlyIfExists:
+		args.Mode = "XX"
+	}
+
+	return args
+}
+
+// SetMany sends one SET per key in a pipeline, which go-redis routes to the node owning each
+// key's hash slot, so it is safe on clusters and rings. Every value is attempted, and the errors
+// of failed keys, including kv.ErrNotSet for unmet conditions, are joined together.
 func (c *KvRedis) SetMany(ctx context.Context, values []kv.SetMany) error {
 	pipe := c.r.Pipeline()
+	cmds := make([]*redis.StatusCmd, len(values))
 
-	for _, v := range values {
-		o := kvoptions.Construct(v.Options...)
-		if err := pipe.Set(ctx, v.Key, v.Value, o.Expire).Err(); err != nil {
+	for i, v := range values {
+		b, err := c.codec.Marshal(v.Value)
+		if err != nil {
 			return err
 		}
+
+		cmds[i] = pipe.SetArgs(ctx, v.Key, b, setArgs(kvoptions.Construct(v.Options...)))
 	}
 
-	_, err := pipe.Exec(ctx)
-	return err
+	// Exec reports the first failed command, the results of all of them are checked below.
+	_, _ = pipe.Exec(ctx)
+
+	var errs []error
+	for i, cmd := range cmds {
+		err := cmd.Err()
+		if errors.Is(err, redis.Nil) {
+			err = kv.ErrNotSet
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to set key %s: %w", values[i].Key, err))
+		}
+	}
+
+	return errors.Join(errs...)
 }
 
 func (c *KvRedis) Delete(ctx context.Context, key string) error {
@@ -68,7 +255,18 @@ func (c *KvRedis) DeleteMany(
 	ctx context.Context,
 	keys []string,
 ) error {
-	return c.r.Del(ctx, keys...).Err()
+	if len(keys) == 0 {
+		return nil
+	}
+
+	_, err := c.r.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, group := range c.keyGroups(keys) {
+			pipe.Del(ctx, pick(keys, group)...)
+		}
+		return nil
+	})
+
+	return err
 }
 
 func (c *KvRedis) Exists(ctx context.Context, key string) (bool, error) {
@@ -112,15 +310,307 @@ func (c *KvRedis) ExistsMany(ctx context.Context, keys []string) ([]bool, error)
 func (c *KvRedis) GetKeysByPattern(ctx context.Context, pattern string) ([]string, error) {
 	var keys []string
 
-	iter := c.r.Scan(ctx, 0, pattern, 0).Iterator()
+	for key, err := range c.ScanKeys(ctx, pattern) {
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// ScanKeys scans every master of a cluster and every shard of a ring one after another.
+func (c *KvRedis) ScanKeys(ctx context.Context, pattern string) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		nodes, err := c.nodes(ctx)
+		if err != nil {
+			yield("", err)
+			return
+		}
+
+		for _, node := range nodes {
+			it := node.Scan(ctx, 0, pattern, c.scanCount).Iterator()
+
+			for it.Next(ctx) {
+				if err := ctx.Err(); err != nil {
+					yield("", err)
+					return
+				}
+				if !yield(it.Val(), nil) {
+					return
+				}
+			}
+
+			if err := it.Err(); err != nil {
+				yield("", err)
+				return
+			}
+		}
+	}
+}
+
+// unlink removes keys with UNLINK, split into slot-safe commands, and returns the number of removed keys.
+func (c *KvRedis) unlink(ctx context.Context, keys []string) (int64, error) {
+	groups := c.keyGroups(keys)
+	cmds := make([]*redis.IntCmd, len(groups))
+
+	_, err := c.r.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, group := range groups {
+			cmds[i] = pipe.Unlink(ctx, pick(keys, group)...)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var deleted int64
+	for _, cmd := range cmds {
+		deleted += cmd.Val()
+	}
+
+	return deleted, nil
+}
+
+// deleteBatchSize is the number of scanned keys removed by a single UNLINK in DeleteByPattern.
+const deleteBatchSize = 500
+
+func (c *KvRedis) DeleteByPattern(ctx context.Context, pattern string) (int64, error) {
+	var (
+		deleted int64
+		batch   = make([]string, 0, deleteBatchSize)
+	)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		n, err := c.unlink(ctx, batch)
+		if err != nil {
+			return err
+		}
+
+		deleted += n
+		batch = batch[:0]
+
+		return nil
+	}
+
+	for key, err := range c.ScanKeys(ctx, pattern) {
+		if err != nil {
+			return deleted, err
+		}
+
+		batch = append(batch, key)
+		if len(batch) == deleteBatchSize {
+			if err := flush(); err != nil {
+				return deleted, err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return deleted, err
+	}
+
+	return deleted, nil
+}
+
+func (c *KvRedis) Incr(ctx context.Context, key string, options ...kvoptions.Option) (int64, error) {
+	return c.IncrBy(ctx, key, 1, options...)
+}
+
+func (c *KvRedis) IncrBy(
+	ctx context.Context,
+	key string,
+	delta int64,
+	options ...kvoptions.Option,
+) (int64, error) {
+	o := kvoptions.Construct(options...)
+	if o.Expire <= 0 {
+		return c.r.IncrBy(ctx, key, delta).Result()
+	}
 
-	for iter.Next(ctx) {
-		keys = append(keys, iter.Val())
+	var incr *redis.IntCmd
+	_, err := c.r.TxPipelined(
+		ctx,
+		func(pipe redis.Pipeliner) error {
+			pipe.SetNX(ctx, key, 0, o.Expire)
+			incr = pipe.IncrBy(ctx, key, delta)
+			return nil
+		},
+	)
+	if err != nil {
+		return 0, err
 	}
 
-	if err := iter.Err(); err != nil {
+	return incr.Val(), nil
+}
+
+func (c *KvRedis) IncrByFloat(
+	ctx context.Context,
+	key string,
+	delta float64,
+	options ...kvoptions.Option,
+) (float64, error) {
+	o := kvoptions.Construct(options...)
+	if o.Expire <= 0 {
+		return c.r.IncrByFloat(ctx, key, delta).Result()
+	}
+
+	var incr *redis.FloatCmd
+	_, err := c.r.TxPipelined(
+		ctx,
+		func(pipe redis.Pipeliner) error {
+			pipe.SetNX(ctx, key, 0, o.Expire)
+			incr = pipe.IncrByFloat(ctx, key, delta)
+			return nil
+		},
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return incr.Val(), nil
+}
+
+func (c *KvRedis) Decr(ctx context.Context, key string, options ...kvoptions.Option) (int64, error) {
+	return c.IncrBy(ctx, key, -1, options...)
+}
+
+func (c *KvRedis) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := c.r.PTTL(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	switch ttl {
+	case -2:
+		return 0, kv.ErrKeyNil
+	case -1:
+		return kv.NoExpiration, nil
+	}
+
+	return ttl, nil
+}
+
+func (c *KvRedis) TTLMany(ctx context.Context, keys []string) ([]time.Duration, error) {
+	results := make([]time.Duration, len(keys))
+	if len(keys) == 0 {
+		return results, nil
+	}
+
+	cmds := make([]*redis.DurationCmd, len(keys))
+	_, err := c.r.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.PTTL(ctx, key)
+		}
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	return keys, nil
+	for i, cmd := range cmds {
+		switch ttl := cmd.Val(); ttl {
+		case -2:
+		case -1:
+			results[i] = kv.NoExpiration
+		default:
+			results[i] = ttl
+		}
+	}
+
+	return results, nil
+}
+
+func (c *KvRedis) Expire(ctx context.Context, key string, d time.Duration) error {
+	ok, err := c.r.PExpire(ctx, key, d).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return kv.ErrKeyNil
+	}
+
+	return nil
+}
+
+func (c *KvRedis) ExpireAt(ctx context.Context, key string, t time.Time) error {
+	ok, err := c.r.PExpireAt(ctx, key, time.UnixMilli(valueversion.UnixMilli(t))).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return kv.ErrKeyNil
+	}
+
+	return nil
+}
+
+func (c *KvRedis) Persist(ctx context.Context, key string) error {
+	ok, err := c.r.Persist(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	if ok {
+		return nil
+	}
+
+	// PERSIST also reports false for keys without an expiration.
+	exists, err := c.Exists(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return kv.ErrKeyNil
+	}
+
+	return nil
+}
+
+var compareAndSwapScript = redis.NewScript(valueversion.CompareAndSwapScript)
+
+func (c *KvRedis) GetWithVersion(ctx context.Context, key string) (kv.Valuer, kv.Version) {
+	v := c.Get(ctx, key)
+	if v.Err() != nil {
+		return v, ""
+	}
+
+	b, _ := v.Bytes()
+	return v, kv.Version(valueversion.Of(b))
+}
+
+func (c *KvRedis) CompareAndSwap(
+	ctx context.Context,
+	key string,
+	version kv.Version,
+	value any,
+	options ...kvoptions.Option,
+) error {
+	o := kvoptions.Construct(options...)
+
+	b, err := c.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	swapped, err := compareAndSwapScript.Run(
+		ctx,
+		c.r,
+		[]string{key},
+		string(version),
+		b,
+		valueversion.ExpireArg(o.Expire),
+	).Int()
+	if err != nil {
+		return err
+	}
+	if swapped == 0 {
+		return kv.ErrVersionMismatch
+	}
+
+	return nil
 }
@@ -2,12 +2,17 @@ package stores
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
 	"os"
 	"reflect"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/bradfitz/gomemcache/memcache"
 	"github.com/redis/go-redis/v9"
@@ -16,10 +21,12 @@ import (
 	tcredis "github.com/testcontainers/testcontainers-go/modules/redis"
 	tcvalkey "github.com/testcontainers/testcontainers-go/modules/valkey"
 	"github.com/twirapp/kv"
+	kvoptions "github.com/twirapp/kv/options"
 	kvinmemory "github.com/twirapp/kv/stores/inmemory"
 	kvmemcached "github.com/twirapp/kv/stores/memcached"
 	kvotter "github.com/twirapp/kv/stores/otter"
 	kvredis "github.com/twirapp/kv/stores/redis"
+	kvtiered "github.com/twirapp/kv/stores/tiered"
 	kvvalkey "github.com/twirapp/kv/stores/valkey"
 	glide "github.com/valkey-io/valkey-glide/go/v2"
 	glideconfig "github.com/valkey-io/valkey-glide/go/v2/config"
@@ -46,6 +53,12 @@ var (
 				return kvotter.New()
 			},
 		},
+		{
+			name: "Tiered",
+			create: func() kv.KV {
+				return kvtiered.New(kvotter.New(), kvinmemory.New())
+			},
+		},
 		{
 			name: "Redis",
 			create: func() kv.KV {
@@ -77,6 +90,12 @@ var (
 				return kvredis.New(redis.NewClient(rOpts))
 			},
 		},
+		{
+			name: "Redis Cluster",
+			create: func() kv.KV {
+				return kvredis.New(newRedisCluster(3))
+			},
+		},
 		{
 			name: "Memcached",
 			create: func() kv.KV {
@@ -137,50 +156,292 @@ var (
 					os.Exit(1)
 				}
 
-				return kvvalkey.NewGlide(client)
+				return kvvalkey.NewGlide(client, kvvalkey.WithScanCount(10))
 			},
 		},
 		{
 			name: "Valkey",
 			create: func() kv.KV {
-				ctx := context.Background()
-				vc, err := tcvalkey.Run(
-					ctx,
-					"valkey/valkey:latest",
-					tc.WithCmd("valkey-server", "--io-threads", "4"),
-				)
-				if err != nil {
-					fmt.Printf("Could not start valkey container: %v\n", err)
-					os.Exit(1)
-				}
-				connString, err := vc.ConnectionString(ctx)
-				if err != nil {
-					fmt.Printf("Could not get valkey connection string: %v\n", err)
-					os.Exit(1)
+				return kvvalkey.New(newValkeyClient(), kvvalkey.WithScanCount(10))
+			},
+		},
+		{
+			name: "Valkey Glide Cluster",
+			create: func() kv.KV {
+				config := glideconfig.NewClusterClientConfiguration()
+				for _, addr := range newValkeyCluster(3) {
+					host, port, err := net.SplitHostPort(addr)
+					if err != nil {
+						fmt.Printf("Could not parse valkey cluster address: %v\n", err)
+						os.Exit(1)
+					}
+					portNum, err := strconv.Atoi(port)
+					if err != nil {
+						fmt.Printf("Could not parse valkey cluster port: %v\n", err)
+						os.Exit(1)
+					}
+					config.WithAddress(&glideconfig.NodeAddress{Host: host, Port: portNum})
 				}
 
-				opts, err := valkey.ParseURL(connString)
+				client, err := glide.NewClusterClient(config)
 				if err != nil {
-					fmt.Printf("Could not parse valkey connection string: %v\n", err)
+					fmt.Printf("Could not create valkey glide cluster client: %v\n", err)
 					os.Exit(1)
 				}
 
-				containersLock.Lock()
-				containers = append(containers, vc)
-				containersLock.Unlock()
-
-				client, err := valkey.NewClient(opts)
+				return kvvalkey.NewGlideCluster(client, kvvalkey.WithScanCount(10))
+			},
+		},
+		{
+			name: "Valkey Cluster",
+			create: func() kv.KV {
+				client, err := valkey.NewClient(valkey.ClientOption{InitAddress: newValkeyCluster(3)})
 				if err != nil {
-					fmt.Printf("Could not create valkey glide client: %v\n", err)
+					fmt.Printf("Could not create valkey cluster client: %v\n", err)
 					os.Exit(1)
 				}
 
-				return kvvalkey.New(client)
+				return kvvalkey.New(client, kvvalkey.WithScanCount(10))
+			},
+		},
+		{
+			name: "Valkey Client Cache",
+			create: func() kv.KV {
+				return kvvalkey.New(
+					newValkeyClient(),
+					kvvalkey.WithScanCount(10),
+					kvvalkey.WithClientCache(time.Minute),
+				)
 			},
 		},
 	}
 )
 
+// newRedisCluster starts n cluster-enabled Redis nodes, joins them into a cluster with the
+// hash slots spread evenly and returns a cluster client. The nodes talk to each other over the
+// container network and announce their mapped host ports to clients.
+func newRedisCluster(n int) *redis.ClusterClient {
+	ctx := context.Background()
+
+	var (
+		addrs = make([]string, n)
+		ips   = make([]string, n)
+		nodes = make([]*redis.Client, n)
+	)
+
+	for i := range n {
+		rc, err := tcredis.Run(
+			ctx,
+			"redis:8",
+			tc.WithCmd(
+				"redis-server",
+				"--cluster-enabled", "yes",
+				"--cluster-preferred-endpoint-type", "hostname",
+				"--cluster-announce-bus-port", "16379",
+			),
+		)
+		if err != nil {
+			fmt.Printf("Could not start redis cluster container: %v\n", err)
+			os.Exit(1)
+		}
+
+		containersLock.Lock()
+		containers = append(containers, rc)
+		containersLock.Unlock()
+
+		host, err := rc.Host(ctx)
+		if err != nil {
+			fmt.Printf("Could not get redis host: %v\n", err)
+			os.Exit(1)
+		}
+		port, err := rc.MappedPort(ctx, "6379/tcp")
+		if err != nil {
+			fmt.Printf("Could not get redis port: %v\n", err)
+			os.Exit(1)
+		}
+		ips[i], err = rc.ContainerIP(ctx)
+		if err != nil {
+			fmt.Printf("Could not get redis container ip: %v\n", err)
+			os.Exit(1)
+		}
+
+		addrs[i] = net.JoinHostPort(host, port.Port())
+		nodes[i] = redis.NewClient(&redis.Options{Addr: addrs[i]})
+		defer nodes[i].Close()
+
+		for _, cmd := range [][]any{
+			{"CONFIG", "SET", "cluster-announce-hostname", host},
+			{"CONFIG", "SET", "cluster-announce-port", port.Port()},
+			{"CLUSTER", "ADDSLOTSRANGE", i * 16384 / n, (i+1)*16384/n - 1},
+		} {
+			if err := nodes[i].Do(ctx, cmd...).Err(); err != nil {
+				fmt.Printf("Could not configure redis cluster node: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	for i := 1; i < n; i++ {
+		if err := nodes[0].ClusterMeet(ctx, ips[i], "6379").Err(); err != nil {
+			fmt.Printf("Could not join redis cluster node: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	for _, node := range nodes {
+		for deadline := time.Now().Add(30 * time.Second); ; {
+			info, err := node.ClusterInfo(ctx).Result()
+			if err == nil &&
+				strings.Contains(info, "cluster_state:ok") &&
+				strings.Contains(info, fmt.Sprintf("cluster_known_nodes:%d", n)) {
+				break
+			}
+			if time.Now().After(deadline) {
+				fmt.Printf("Redis cluster did not become ready: %v %s\n", err, info)
+				os.Exit(1)
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+
+	return redis.NewClusterClient(&redis.ClusterOptions{Addrs: addrs})
+}
+
+// newValkeyCluster starts n cluster-enabled Valkey nodes, joins them into a cluster with the
+// hash slots spread evenly and returns their addresses. The nodes talk to each other over the
+// container network and announce their mapped host ports to clients.
+func newValkeyCluster(n int) []string {
+	ctx := context.Background()
+
+	var (
+		addrs = make([]string, n)
+		ips   = make([]string, n)
+		nodes = make([]valkey.Client, n)
+	)
+
+	for i := range n {
+		vc, err := tcvalkey.Run(
+			ctx,
+			"valkey/valkey:latest",
+			tc.WithCmd(
+				"valkey-server",
+				"--cluster-enabled", "yes",
+				"--cluster-preferred-endpoint-type", "hostname",
+				"--cluster-announce-bus-port", "16379",
+			),
+		)
+		if err != nil {
+			fmt.Printf("Could not start valkey cluster container: %v\n", err)
+			os.Exit(1)
+		}
+
+		containersLock.Lock()
+		containers = append(containers, vc)
+		containersLock.Unlock()
+
+		host, err := vc.Host(ctx)
+		if err != nil {
+			fmt.Printf("Could not get valkey host: %v\n", err)
+			os.Exit(1)
+		}
+		port, err := vc.MappedPort(ctx, "6379/tcp")
+		if err != nil {
+			fmt.Printf("Could not get valkey port: %v\n", err)
+			os.Exit(1)
+		}
+		ips[i], err = vc.ContainerIP(ctx)
+		if err != nil {
+			fmt.Printf("Could not get valkey container ip: %v\n", err)
+			os.Exit(1)
+		}
+
+		addrs[i] = net.JoinHostPort(host, port.Port())
+		nodes[i], err = valkey.NewClient(valkey.ClientOption{
+			InitAddress:       []string{addrs[i]},
+			ForceSingleClient: true,
+			DisableCache:      true,
+		})
+		if err != nil {
+			fmt.Printf("Could not connect to valkey cluster node: %v\n", err)
+			os.Exit(1)
+		}
+		defer nodes[i].Close()
+
+		for _, cmd := range [][]string{
+			{"CONFIG", "SET", "cluster-announce-hostname", host},
+			{"CONFIG", "SET", "cluster-announce-port", port.Port()},
+			{"CLUSTER", "ADDSLOTSRANGE", strconv.Itoa(i * 16384 / n), strconv.Itoa((i+1)*16384/n - 1)},
+		} {
+			if err := nodes[i].Do(ctx, nodes[i].B().Arbitrary(cmd...).Build()).Error(); err != nil {
+				fmt.Printf("Could not configure valkey cluster node: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	for i := 1; i < n; i++ {
+		meet := nodes[0].B().Arbitrary("CLUSTER", "MEET", ips[i], "6379", "16379").Build()
+		if err := nodes[0].Do(ctx, meet).Error(); err != nil {
+			fmt.Printf("Could not join valkey cluster node: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	for _, node := range nodes {
+		for deadline := time.Now().Add(30 * time.Second); ; {
+			info, err := node.Do(ctx, node.B().ClusterInfo().Build()).ToString()
+			if err == nil &&
+				strings.Contains(info, "cluster_state:ok") &&
+				strings.Contains(info, fmt.Sprintf("cluster_known_nodes:%d", n)) {
+				break
+			}
+			if time.Now().After(deadline) {
+				fmt.Printf("Valkey cluster did not become ready: %v %s\n", err, info)
+				os.Exit(1)
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+
+	return addrs
+}
+
+func newValkeyClient() valkey.Client {
+	ctx := context.Background()
+	vc, err := tcvalkey.Run(
+		ctx,
+		"valkey/valkey:latest",
+		tc.WithCmd("valkey-server", "--io-threads", "4"),
+	)
+	if err != nil {
+		fmt.Printf("Could not start valkey container: %v\n", err)
+		os.Exit(1)
+	}
+	connString, err := vc.ConnectionString(ctx)
+	if err != nil {
+		fmt.Printf("Could not get valkey connection string: %v\n", err)
+		os.Exit(1)
+	}
+
+	opts, err := valkey.ParseURL(connString)
+	if err != nil {
+		fmt.Printf("Could not parse valkey connection string: %v\n", err)
+		os.Exit(1)
+	}
+
+	containersLock.Lock()
+	containers = append(containers, vc)
+	containersLock.Unlock()
+
+	client, err := valkey.NewClient(opts)
+	if err != nil {
+		fmt.Printf("Could not create valkey client: %v\n", err)
+		os.Exit(1)
+	}
+
+	return client
+}
+
 func TestMain(m *testing.M) {
 	// Run all the tests in the package
 	exitCode := m.Run()
@@ -352,6 +613,50 @@ func TestStore_DeleteMany(t *testing.T) {
 
 }
 
+func TestStore_DeleteByPattern(t *testing.T) {
+	t.Parallel()
+
+	for _, impl := range implementations {
+		t.Run(fmt.Sprintf("%s: DeleteByPattern", impl.name), func(t *testing.T) {
+			c := impl.create()
+			ctx := context.Background()
+
+			if impl.name == "Memcached" {
+				if _, err := c.DeleteByPattern(ctx, "*"); !errors.Is(err, kv.ErrNotSupported) {
+					t.Errorf("DeleteByPattern() error = %v, want %v", err, kv.ErrNotSupported)
+				}
+				return
+			}
+
+			items := make([]kv.SetMany, 0, 1001)
+			for i := range 1000 {
+				items = append(items, kv.SetMany{Key: fmt.Sprintf("channel:1:%d", i), Value: "value"})
+			}
+			items = append(items, kv.SetMany{Key: "channel:2:1", Value: "value"})
+
+			if err := c.SetMany(ctx, items); err != nil {
+				t.Fatalf("failed to set up test: %v", err)
+			}
+
+			deleted, err := c.DeleteByPattern(ctx, "channel:1:*")
+			if err != nil {
+				t.Fatalf("DeleteByPattern() error = %v", err)
+			}
+			if deleted != 1000 {
+				t.Errorf("DeleteByPattern() got = %v, want %v", deleted, 1000)
+			}
+
+			keys, err := c.GetKeysByPattern(ctx, "channel:*")
+			if err != nil {
+				t.Fatalf("GetKeysByPattern() error = %v", err)
+			}
+			if !reflect.DeepEqual(keys, []string{"channel:2:1"}) {
+				t.Errorf("GetKeysByPattern() after DeleteByPattern() got = %v, want %v", keys, []string{"channel:2:1"})
+			}
+		})
+	}
+}
+
 func TestStore_Exists(t *testing.T) {
 	t.Parallel()
 
@@ -443,6 +748,371 @@ func TestStore_Get(t *testing.T) {
 
 }
 
+func TestStore_GetAs(t *testing.T) {
+	t.Parallel()
+
+	type user struct {
+		Name string `kv:"name" json:"name"`
+		Age  int    `kv:"age" json:"age"`
+	}
+
+	for _, impl := range implementations {
+		t.Run(fmt.Sprintf("%s: GetAs", impl.name), func(t *testing.T) {
+			c := impl.create()
+			ctx := context.Background()
+
+			if err := kv.SetAs(ctx, c, "int", 42); err != nil {
+				t.Fatalf("SetAs() int error = %v", err)
+			}
+			if got, err := kv.GetAs[int](ctx, c, "int"); err != nil || got != 42 {
+				t.Errorf("GetAs[int]() got = %v, %v, want 42", got, err)
+			}
+
+			at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+			if err := kv.SetAs(ctx, c, "time", at); err != nil {
+				t.Fatalf("SetAs() time error = %v", err)
+			}
+			if got, err := kv.GetAs[time.Time](ctx, c, "time"); err != nil || !got.Equal(at) {
+				t.Errorf("GetAs[time.Time]() got = %v, %v, want %v", got, err, at)
+			}
+
+			want := user{Name: "John", Age: 30}
+			if err := kv.SetAs(ctx, c, "user:1", want); err != nil {
+				t.Fatalf("SetAs() struct error = %v", err)
+			}
+			if got, err := kv.GetAs[user](ctx, c, "user:1"); err != nil || got != want {
+				t.Errorf("GetAs[user]() got = %v, %v, want %v", got, err, want)
+			}
+
+			if _, err := kv.GetAs[int](ctx, c, "missing"); !errors.Is(err, kv.ErrKeyNil) {
+				t.Errorf("GetAs() on missing key error = %v, want %v", err, kv.ErrKeyNil)
+			}
+
+			if err := kv.SetAs(ctx, c, "user:2", user{Name: "Jane", Age: 25}); err != nil {
+				t.Fatalf("SetAs() struct error = %v", err)
+			}
+			users, errs := kv.GetManyAs[user](ctx, c, []string{"user:1", "missing", "user:2"})
+			if errs[0] != nil || users[0] != want {
+				t.Errorf("GetManyAs()[0] got = %v, %v, want %v", users[0], errs[0], want)
+			}
+			if !errors.Is(errs[1], kv.ErrKeyNil) {
+				t.Errorf("GetManyAs()[1] error = %v, want %v", errs[1], kv.ErrKeyNil)
+			}
+			if errs[2] != nil || users[2].Name != "Jane" {
+				t.Errorf("GetManyAs()[2] got = %v, %v, want Jane", users[2], errs[2])
+			}
+		})
+	}
+}
+
+func TestStore_ManyKeysAcrossSlots(t *testing.T) {
+	t.Parallel()
+
+	for _, impl := range implementations {
+		t.Run(fmt.Sprintf("%s: ManyKeysAcrossSlots", impl.name), func(t *testing.T) {
+			c := impl.create()
+			ctx := context.Background()
+
+			// Fifty keys land in different hash slots, and on different nodes of a cluster.
+			keys := make([]string, 50)
+			values := make([]kv.SetMany, len(keys))
+			for i := range keys {
+				keys[i] = fmt.Sprintf("slot-key:%d", i)
+				values[i] = kv.SetMany{Key: keys[i], Value: i}
+			}
+
+			if err := c.SetMany(ctx, values); err != nil {
+				t.Fatalf("SetMany() error = %v", err)
+			}
+
+			for i, v := range c.GetMany(ctx, keys) {
+				if got, err := v.Int(); err != nil || got != int64(i) {
+					t.Errorf("GetMany()[%d] got = %v, %v, want %d", i, got, err, i)
+				}
+			}
+
+			if impl.name != "Memcached" {
+				got, err := c.GetKeysByPattern(ctx, "slot-key:*")
+				if err != nil || len(got) != len(keys) {
+					t.Errorf("GetKeysByPattern() got %d keys, %v, want %d", len(got), err, len(keys))
+				}
+			}
+
+			if err := c.DeleteMany(ctx, keys); err != nil {
+				t.Fatalf("DeleteMany() error = %v", err)
+			}
+
+			exists, err := c.ExistsMany(ctx, keys)
+			if err != nil {
+				t.Fatalf("ExistsMany() error = %v", err)
+			}
+			for i, e := range exists {
+				if e {
+					t.Errorf("ExistsMany()[%d] after DeleteMany() = %v, want false", i, e)
+				}
+			}
+		})
+	}
+}
+
+func TestStore_GetMany(t *testing.T) {
+	t.Parallel()
+
+	for _, impl := range implementations {
+		t.Run(fmt.Sprintf("%s: GetMany", impl.name), func(t *testing.T) {
+			c := impl.create()
+
+			keysToSet := []string{"key1", "key2", "key3"}
+			for _, key := range keysToSet {
+				if err := c.Set(context.Background(), key, "value-"+key); err != nil {
+					t.Fatalf("failed to set up test: %v", err)
+				}
+			}
+
+			keysToGet := []string{"key1", "nonexistent", "key3", "key2"}
+			expected := []string{"value-key1", "", "value-key3", "value-key2"}
+
+			results := c.GetMany(context.Background(), keysToGet)
+			if len(results) != len(keysToGet) {
+				t.Fatalf("GetMany() got %d results, want %d", len(results), len(keysToGet))
+			}
+
+			for i, val := range results {
+				if expected[i] == "" {
+					if !errors.Is(val.Err(), kv.ErrKeyNil) {
+						t.Errorf("GetMany() key %s error = %v, want %v", keysToGet[i], val.Err(), kv.ErrKeyNil)
+					}
+					continue
+				}
+
+				str, err := val.String()
+				if err != nil {
+					t.Errorf("GetMany() key %s error = %v, wantErr %v", keysToGet[i], err, false)
+				} else if str != expected[i] {
+					t.Errorf("GetMany() key %s got = %v, want %v", keysToGet[i], str, expected[i])
+				}
+			}
+
+			if results := c.GetMany(context.Background(), nil); len(results) != 0 {
+				t.Errorf("GetMany() with no keys got = %v, want empty", results)
+			}
+		})
+	}
+}
+
+func TestStore_Counters(t *testing.T) {
+	t.Parallel()
+
+	for _, impl := range implementations {
+		t.Run(fmt.Sprintf("%s: Counters", impl.name), func(t *testing.T) {
+			c := impl.create()
+			ctx := context.Background()
+
+			if got, err := c.Incr(ctx, "counter", kvoptions.WithExpire(time.Minute)); err != nil || got != 1 {
+				t.Errorf("Incr() on missing key got = %v, %v, want 1", got, err)
+			}
+
+			if got, err := c.IncrBy(ctx, "counter", 5); err != nil || got != 6 {
+				t.Errorf("IncrBy() got = %v, %v, want 6", got, err)
+			}
+
+			if got, err := c.Decr(ctx, "counter"); err != nil || got != 5 {
+				t.Errorf("Decr() got = %v, %v, want 5", got, err)
+			}
+
+			str, err := c.Get(ctx, "counter").String()
+			if err != nil || str != "5" {
+				t.Errorf("Get() after counter ops got = %v, %v, want 5", str, err)
+			}
+
+			got, err := c.IncrByFloat(ctx, "float-counter", 1.5)
+			if impl.name == "Memcached" {
+				if !errors.Is(err, kv.ErrNotSupported) {
+					t.Errorf("IncrByFloat() error = %v, want %v", err, kv.ErrNotSupported)
+				}
+				return
+			}
+			if err != nil || got != 1.5 {
+				t.Errorf("IncrByFloat() on missing key got = %v, %v, want 1.5", got, err)
+			}
+
+			if got, err := c.IncrByFloat(ctx, "float-counter", 0.25); err != nil || got != 1.75 {
+				t.Errorf("IncrByFloat() got = %v, %v, want 1.75", got, err)
+			}
+		})
+	}
+}
+
+func TestStore_TTL(t *testing.T) {
+	t.Parallel()
+
+	for _, impl := range implementations {
+		t.Run(fmt.Sprintf("%s: TTL", impl.name), func(t *testing.T) {
+			c := impl.create()
+			ctx := context.Background()
+
+			// Memcached cannot report the remaining lifetime of a key.
+			checkTTL := func(key string, want func(time.Duration) bool) {
+				t.Helper()
+
+				ttl, err := c.TTL(ctx, key)
+				if impl.name == "Memcached" {
+					if !errors.Is(err, kv.ErrNotSupported) {
+						t.Errorf("TTL() error = %v, want %v", err, kv.ErrNotSupported)
+					}
+					return
+				}
+				if err != nil {
+					t.Errorf("TTL() error = %v, wantErr %v", err, false)
+				} else if !want(ttl) {
+					t.Errorf("TTL() got unexpected = %v", ttl)
+				}
+			}
+			isPersistent := func(ttl time.Duration) bool { return ttl == kv.NoExpiration }
+			isWithinMinute := func(ttl time.Duration) bool { return ttl > 0 && ttl <= time.Minute }
+
+			if err := c.Set(ctx, "key1", "value1"); err != nil {
+				t.Fatalf("failed to set up test: %v", err)
+			}
+			checkTTL("key1", isPersistent)
+
+			if err := c.Expire(ctx, "key1", time.Minute); err != nil {
+				t.Errorf("Expire() error = %v, wantErr %v", err, false)
+			}
+			checkTTL("key1", isWithinMinute)
+
+			if err := c.Persist(ctx, "key1"); err != nil {
+				t.Errorf("Persist() error = %v, wantErr %v", err, false)
+			}
+			checkTTL("key1", isPersistent)
+
+			if err := c.ExpireAt(ctx, "key1", time.Now().Add(time.Minute)); err != nil {
+				t.Errorf("ExpireAt() error = %v, wantErr %v", err, false)
+			}
+			checkTTL("key1", isWithinMinute)
+
+			if err := c.ExpireAt(ctx, "key1", time.Now().Add(-time.Minute)); err != nil {
+				t.Errorf("ExpireAt() in the past error = %v, wantErr %v", err, false)
+			}
+			if err := c.Get(ctx, "key1").Err(); !errors.Is(err, kv.ErrKeyNil) {
+				t.Errorf("Get() after ExpireAt() in the past error = %v, want %v", err, kv.ErrKeyNil)
+			}
+
+			// A sub-millisecond expiration is rounded up instead of deleting the key right away.
+			if err := c.Set(ctx, "short", "value"); err != nil {
+				t.Fatalf("failed to set up test: %v", err)
+			}
+			if err := c.Expire(ctx, "short", 500*time.Microsecond); err != nil {
+				t.Errorf("Expire() sub-millisecond error = %v, wantErr %v", err, false)
+			}
+			if exists, err := c.Exists(ctx, "short"); err != nil || !exists {
+				t.Errorf("Exists() after sub-millisecond Expire() got = %v, %v, want true", exists, err)
+			}
+
+			if err := c.Expire(ctx, "nonexistent", time.Minute); !errors.Is(err, kv.ErrKeyNil) {
+				t.Errorf("Expire() on missing key error = %v, want %v", err, kv.ErrKeyNil)
+			}
+			if err := c.Persist(ctx, "nonexistent"); !errors.Is(err, kv.ErrKeyNil) {
+				t.Errorf("Persist() on missing key error = %v, want %v", err, kv.ErrKeyNil)
+			}
+			if _, err := c.TTL(ctx, "nonexistent"); impl.name != "Memcached" && !errors.Is(err, kv.ErrKeyNil) {
+				t.Errorf("TTL() on missing key error = %v, want %v", err, kv.ErrKeyNil)
+			}
+
+			// The expiration of a counter is applied only when it is created.
+			if _, err := c.Incr(ctx, "counter", kvoptions.WithExpire(time.Minute)); err != nil {
+				t.Fatalf("Incr() error = %v", err)
+			}
+			checkTTL("counter", isWithinMinute)
+
+			if err := c.Persist(ctx, "counter"); err != nil {
+				t.Errorf("Persist() error = %v, wantErr %v", err, false)
+			}
+			if _, err := c.Incr(ctx, "counter", kvoptions.WithExpire(time.Minute)); err != nil {
+				t.Fatalf("Incr() error = %v", err)
+			}
+			checkTTL("counter", isPersistent)
+		})
+	}
+}
+
+func TestStore_TTLMany(t *testing.T) {
+	t.Parallel()
+
+	for _, impl := range implementations {
+		t.Run(fmt.Sprintf("%s: TTLMany", impl.name), func(t *testing.T) {
+			c, ok := impl.create().(kv.TTLManyProvider)
+			if !ok {
+				t.Skip("store does not implement kv.TTLManyProvider")
+			}
+			ctx := context.Background()
+
+			if err := c.(kv.KV).Set(ctx, "persistent", "value"); err != nil {
+				t.Fatalf("failed to set up test: %v", err)
+			}
+			if err := c.(kv.KV).Set(ctx, "expiring", "value", kvoptions.WithExpire(time.Minute)); err != nil {
+				t.Fatalf("failed to set up test: %v", err)
+			}
+
+			got, err := c.TTLMany(ctx, []string{"persistent", "missing", "expiring"})
+			if err != nil {
+				t.Fatalf("TTLMany() error = %v", err)
+			}
+			if len(got) != 3 || got[0] != kv.NoExpiration || got[1] != 0 || got[2] <= 0 || got[2] > time.Minute {
+				t.Errorf("TTLMany() got = %v, want [%v 0 up to %v]", got, kv.NoExpiration, time.Minute)
+			}
+
+			if got, err := c.TTLMany(ctx, nil); err != nil || len(got) != 0 {
+				t.Errorf("TTLMany() empty got = %v, %v, want empty", got, err)
+			}
+		})
+	}
+}
+
+func TestStore_CompareAndSwap(t *testing.T) {
+	t.Parallel()
+
+	for _, impl := range implementations {
+		t.Run(fmt.Sprintf("%s: CompareAndSwap", impl.name), func(t *testing.T) {
+			c := impl.create()
+			ctx := context.Background()
+
+			if err := c.Set(ctx, "key1", "value1"); err != nil {
+				t.Fatalf("failed to set up test: %v", err)
+			}
+
+			val, version := c.GetWithVersion(ctx, "key1")
+			if str, err := val.String(); err != nil || str != "value1" {
+				t.Fatalf("GetWithVersion() got = %v, %v, want %v", str, err, "value1")
+			}
+
+			if err := c.CompareAndSwap(ctx, "key1", version, "value2"); err != nil {
+				t.Errorf("CompareAndSwap() error = %v, wantErr %v", err, false)
+			}
+
+			if err := c.CompareAndSwap(ctx, "key1", version, "value3"); !errors.Is(err, kv.ErrVersionMismatch) {
+				t.Errorf("CompareAndSwap() with stale version error = %v, want %v", err, kv.ErrVersionMismatch)
+			}
+
+			if str, _ := c.Get(ctx, "key1").String(); str != "value2" {
+				t.Errorf("Get() after CompareAndSwap() got = %v, want %v", str, "value2")
+			}
+
+			if err := c.Delete(ctx, "key1"); err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+			_, version = c.GetWithVersion(ctx, "key1")
+			if err := c.CompareAndSwap(ctx, "key1", version, "value4"); !errors.Is(err, kv.ErrVersionMismatch) {
+				t.Errorf("CompareAndSwap() on missing key error = %v, want %v", err, kv.ErrVersionMismatch)
+			}
+
+			if val, _ := c.GetWithVersion(ctx, "nonexistent"); !errors.Is(val.Err(), kv.ErrKeyNil) {
+				t.Errorf("GetWithVersion() on missing key error = %v, want %v", val.Err(), kv.ErrKeyNil)
+			}
+		})
+	}
+}
+
 func TestStore_GetKeysByPattern(t *testing.T) {
 	t.Parallel()
 
@@ -596,6 +1266,249 @@ func TestStore_GetKeysByPattern(t *testing.T) {
 
 }
 
+// TestStore_GetKeysByPattern_GlobConformance checks that every store agrees with Redis
+// on the glob syntax of KEYS and SCAN MATCH.
+func TestStore_GetKeysByPattern_GlobConformance(t *testing.T) {
+	t.Parallel()
+
+	keys := []string{
+		"user:1",
+		"user:12",
+		"user:123",
+		"user:a",
+		"user:*",
+		"user:1:name",
+		"user:2:email",
+		"hello",
+		"hallo",
+		"hxllo",
+	}
+
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{pattern: "user:12*", want: []string{"user:12", "user:123"}},
+		{pattern: "user:?", want: []string{"user:1", "user:a", "user:*"}},
+		{pattern: "user:*:name", want: []string{"user:1:name"}},
+		{pattern: "h[ae]llo", want: []string{"hello", "hallo"}},
+		{pattern: "h[^e]llo", want: []string{"hallo", "hxllo"}},
+		{pattern: "user:[0-9]", want: []string{"user:1"}},
+		{pattern: "user:\\*", want: []string{"user:*"}},
+		{pattern: "*[0-9]", want: []string{"user:1", "user:12", "user:123"}},
+	}
+
+	for _, impl := range implementations {
+		if impl.name == "Memcached" {
+			// Skip Memcached as it does not support GetKeysByPattern
+			continue
+		}
+
+		t.Run(fmt.Sprintf("%s: GetKeysByPattern glob conformance", impl.name), func(t *testing.T) {
+			c := impl.create()
+
+			items := make([]kv.SetMany, len(keys))
+			for i, key := range keys {
+				items[i] = kv.SetMany{Key: key, Value: "value"}
+			}
+			if err := c.SetMany(context.Background(), items); err != nil {
+				t.Fatalf("failed to set up test: %v", err)
+			}
+
+			for _, tt := range tests {
+				got, err := c.GetKeysByPattern(context.Background(), tt.pattern)
+				if err != nil {
+					t.Errorf("GetKeysByPattern(%q) error = %v", tt.pattern, err)
+					continue
+				}
+
+				slices.Sort(got)
+				want := slices.Sorted(slices.Values(tt.want))
+				if !slices.Equal(got, want) {
+					t.Errorf("GetKeysByPattern(%q) got = %v, want %v", tt.pattern, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestStore_GetKeysByPattern_ManyKeys(t *testing.T) {
+	t.Parallel()
+
+	const count = 500
+
+	for _, impl := range implementations {
+		if impl.name == "Memcached" {
+			// Skip Memcached as it does not support GetKeysByPattern
+			continue
+		}
+
+		t.Run(fmt.Sprintf("%s: GetKeysByPattern many keys", impl.name), func(t *testing.T) {
+			c := impl.create()
+
+			items := make([]kv.SetMany, 0, count+1)
+			for i := range count {
+				items = append(items, kv.SetMany{Key: fmt.Sprintf("bulk:%d", i), Value: "value"})
+			}
+			items = append(items, kv.SetMany{Key: "other:1", Value: "value"})
+
+			if err := c.SetMany(context.Background(), items); err != nil {
+				t.Fatalf("failed to set up test: %v", err)
+			}
+
+			got, err := c.GetKeysByPattern(context.Background(), "bulk:*")
+			if err != nil {
+				t.Fatalf("GetKeysByPattern() error = %v", err)
+			}
+
+			unique := make(map[string]struct{}, len(got))
+			for _, key := range got {
+				unique[key] = struct{}{}
+			}
+
+			if len(unique) != count {
+				t.Errorf("GetKeysByPattern() got %d keys, want %d", len(unique), count)
+			}
+		})
+	}
+}
+
+func TestStore_ScanKeys(t *testing.T) {
+	t.Parallel()
+
+	for _, impl := range implementations {
+		t.Run(fmt.Sprintf("%s: ScanKeys", impl.name), func(t *testing.T) {
+			c := impl.create()
+
+			if impl.name == "Memcached" {
+				for _, err := range c.ScanKeys(context.Background(), "*") {
+					if !errors.Is(err, kv.ErrNotSupported) {
+						t.Errorf("ScanKeys() error = %v, want %v", err, kv.ErrNotSupported)
+					}
+				}
+				return
+			}
+
+			items := []kv.SetMany{
+				{Key: "scan:1", Value: "value"},
+				{Key: "scan:2", Value: "value"},
+				{Key: "scan:3", Value: "value"},
+				{Key: "other:1", Value: "value"},
+			}
+			if err := c.SetMany(context.Background(), items); err != nil {
+				t.Fatalf("failed to set up test: %v", err)
+			}
+
+			got := make(map[string]struct{})
+			for key, err := range c.ScanKeys(context.Background(), "scan:*") {
+				if err != nil {
+					t.Fatalf("ScanKeys() error = %v", err)
+				}
+				got[key] = struct{}{}
+			}
+			if len(got) != 3 {
+				t.Errorf("ScanKeys() got = %v, want 3 keys", got)
+			}
+
+			n := 0
+			for _, err := range c.ScanKeys(context.Background(), "scan:*") {
+				if err != nil {
+					t.Fatalf("ScanKeys() error = %v", err)
+				}
+				n++
+				break
+			}
+			if n != 1 {
+				t.Errorf("ScanKeys() did not stop after break, got %d keys", n)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			var lastErr error
+			for _, err := range c.ScanKeys(ctx, "scan:*") {
+				lastErr = err
+			}
+			if !errors.Is(lastErr, context.Canceled) {
+				t.Errorf("ScanKeys() with cancelled context error = %v, want %v", lastErr, context.Canceled)
+			}
+		})
+	}
+}
+
+func TestStore_Repository(t *testing.T) {
+	t.Parallel()
+
+	type settings struct {
+		Enabled bool   `kv:"enabled" json:"enabled"`
+		Prefix  string `kv:"prefix" json:"prefix"`
+	}
+
+	for _, impl := range implementations {
+		t.Run(fmt.Sprintf("%s: Repository", impl.name), func(t *testing.T) {
+			c := impl.create()
+			ctx := context.Background()
+
+			repo := kv.NewRepository[int, settings](c, "channel:{id}:settings", nil)
+
+			if key := repo.Key(1); key != "channel:1:settings" {
+				t.Errorf("Key() got = %v, want %v", key, "channel:1:settings")
+			}
+
+			first := settings{Enabled: true, Prefix: "!"}
+			second := settings{Enabled: false, Prefix: "?"}
+			if err := repo.Set(ctx, 1, first); err != nil {
+				t.Fatalf("Set() error = %v", err)
+			}
+			if err := repo.Set(ctx, 2, second); err != nil {
+				t.Fatalf("Set() error = %v", err)
+			}
+			if err := c.Set(ctx, "channel:3:other", "value"); err != nil {
+				t.Fatalf("Set() unrelated key error = %v", err)
+			}
+			// Matches the pattern of the template, but its id is not an int.
+			if err := c.Set(ctx, "channel:4:extra:settings", "value"); err != nil {
+				t.Fatalf("Set() unrelated key error = %v", err)
+			}
+
+			if got, err := repo.Get(ctx, 1); err != nil || got != first {
+				t.Errorf("Get() got = %v, %v, want %v", got, err, first)
+			}
+			if _, err := repo.Get(ctx, 3); !errors.Is(err, kv.ErrKeyNil) {
+				t.Errorf("Get() on missing id error = %v, want %v", err, kv.ErrKeyNil)
+			}
+
+			values, errs := repo.GetMany(ctx, []int{2, 3})
+			if errs[0] != nil || values[0] != second {
+				t.Errorf("GetMany()[0] got = %v, %v, want %v", values[0], errs[0], second)
+			}
+			if !errors.Is(errs[1], kv.ErrKeyNil) {
+				t.Errorf("GetMany()[1] error = %v, want %v", errs[1], kv.ErrKeyNil)
+			}
+
+			if exists, err := repo.Exists(ctx, 2); err != nil || !exists {
+				t.Errorf("Exists() got = %v, %v, want true", exists, err)
+			}
+
+			list, err := repo.List(ctx)
+			if impl.name == "Memcached" {
+				if !errors.Is(err, kv.ErrNotSupported) {
+					t.Errorf("List() error = %v, want %v", err, kv.ErrNotSupported)
+				}
+			} else if err != nil || len(list) != 2 {
+				t.Errorf("List() got = %v, %v, want 2 values", list, err)
+			}
+
+			if err := repo.Delete(ctx, 1); err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+			if exists, err := repo.Exists(ctx, 1); err != nil || exists {
+				t.Errorf("Exists() after Delete() got = %v, %v, want false", exists, err)
+			}
+		})
+	}
+}
+
 func TestStore_Set(t *testing.T) {
 	t.Parallel()
 
@@ -624,6 +1537,98 @@ func TestStore_Set(t *testing.T) {
 
 }
 
+func TestStore_SetTypes(t *testing.T) {
+	t.Parallel()
+
+	type user struct {
+		Name string `kv:"name" json:"name"`
+		Age  int    `kv:"age" json:"age"`
+	}
+
+	for _, impl := range implementations {
+		t.Run(fmt.Sprintf("%s: SetTypes", impl.name), func(t *testing.T) {
+			c := impl.create()
+			ctx := context.Background()
+
+			if err := c.Set(ctx, "int", 5); err != nil {
+				t.Fatalf("Set() int error = %v", err)
+			}
+			if got, err := c.Get(ctx, "int").Int(); err != nil || got != 5 {
+				t.Errorf("Get() Int() got = %v, %v, want 5", got, err)
+			}
+			if got, err := c.Incr(ctx, "int"); err != nil || got != 6 {
+				t.Errorf("Incr() after Set() got = %v, %v, want 6", got, err)
+			}
+
+			if err := c.Set(ctx, "bool", true); err != nil {
+				t.Fatalf("Set() bool error = %v", err)
+			}
+			if got, err := c.Get(ctx, "bool").Bool(); err != nil || !got {
+				t.Errorf("Get() Bool() got = %v, %v, want true", got, err)
+			}
+
+			if err := c.Set(ctx, "float", 1.5); err != nil {
+				t.Fatalf("Set() float error = %v", err)
+			}
+			if got, err := c.Get(ctx, "float").Float(); err != nil || got != 1.5 {
+				t.Errorf("Get() Float() got = %v, %v, want 1.5", got, err)
+			}
+
+			want := user{Name: "John", Age: 30}
+			if err := c.Set(ctx, "struct", want); err != nil {
+				t.Fatalf("Set() struct error = %v", err)
+			}
+			var got user
+			if err := c.Get(ctx, "struct").Scan(&got); err != nil || got != want {
+				t.Errorf("Get() Scan() got = %v, %v, want %v", got, err, want)
+			}
+
+			err := c.SetMany(ctx, []kv.SetMany{{Key: "many", Value: int64(-7)}})
+			if err != nil {
+				t.Fatalf("SetMany() error = %v", err)
+			}
+			if got, err := c.GetMany(ctx, []string{"many"})[0].Int(); err != nil || got != -7 {
+				t.Errorf("GetMany() Int() got = %v, %v, want -7", got, err)
+			}
+		})
+	}
+}
+
+func TestStore_SetConditional(t *testing.T) {
+	t.Parallel()
+
+	for _, impl := range implementations {
+		t.Run(fmt.Sprintf("%s: SetConditional", impl.name), func(t *testing.T) {
+			c := impl.create()
+			ctx := context.Background()
+
+			if err := c.Set(ctx, "key1", "value1", kvoptions.WithOnlyIfExists()); !errors.Is(err, kv.ErrNotSet) {
+				t.Errorf("Set() XX on missing key error = %v, want %v", err, kv.ErrNotSet)
+			}
+
+			if err := c.Set(ctx, "key1", "value1", kvoptions.WithOnlyIfNotExists()); err != nil {
+				t.Errorf("Set() NX on missing key error = %v, wantErr %v", err, false)
+			}
+
+			if err := c.Set(ctx, "key1", "value2", kvoptions.WithOnlyIfNotExists()); !errors.Is(err, kv.ErrNotSet) {
+				t.Errorf("Set() NX on existing key error = %v, want %v", err, kv.ErrNotSet)
+			}
+
+			if str, _ := c.Get(ctx, "key1").String(); str != "value1" {
+				t.Errorf("Get() after failed NX got = %v, want %v", str, "value1")
+			}
+
+			if err := c.Set(ctx, "key1", "value3", kvoptions.WithOnlyIfExists()); err != nil {
+				t.Errorf("Set() XX on existing key error = %v, wantErr %v", err, false)
+			}
+
+			if str, _ := c.Get(ctx, "key1").String(); str != "value3" {
+				t.Errorf("Get() after XX got = %v, want %v", str, "value3")
+			}
+		})
+	}
+}
+
 func TestStore_SetMany(t *testing.T) {
 	t.Parallel()
 
@@ -657,3 +1662,46 @@ func TestStore_SetMany(t *testing.T) {
 		})
 	}
 }
+
+func TestStore_SetManyConditional(t *testing.T) {
+	t.Parallel()
+
+	for _, impl := range implementations {
+		t.Run(fmt.Sprintf("%s: SetManyConditional", impl.name), func(t *testing.T) {
+			c := impl.create()
+			ctx := context.Background()
+
+			for _, key := range []string{"existing-nx", "existing-xx"} {
+				if err := c.Set(ctx, key, "old"); err != nil {
+					t.Fatalf("Set() error = %v", err)
+				}
+			}
+
+			err := c.SetMany(ctx, []kv.SetMany{
+				{Key: "plain", Value: "new"},
+				{Key: "existing-nx", Value: "new", Options: []kvoptions.Option{kvoptions.WithOnlyIfNotExists()}},
+				{Key: "missing-nx", Value: "new", Options: []kvoptions.Option{kvoptions.WithOnlyIfNotExists()}},
+				{Key: "existing-xx", Value: "new", Options: []kvoptions.Option{kvoptions.WithOnlyIfExists()}},
+				{Key: "missing-xx", Value: "new", Options: []kvoptions.Option{kvoptions.WithOnlyIfExists()}},
+			})
+			if !errors.Is(err, kv.ErrNotSet) {
+				t.Errorf("SetMany() error = %v, want %v", err, kv.ErrNotSet)
+			}
+
+			for key, want := range map[string]string{
+				"plain":       "new",
+				"existing-nx": "old",
+				"missing-nx":  "new",
+				"existing-xx": "new",
+			} {
+				if got, err := c.Get(ctx, key).String(); err != nil || got != want {
+					t.Errorf("Get(%q) after SetMany() got = %v, %v, want %v", key, got, err, want)
+				}
+			}
+
+			if exists, err := c.Exists(ctx, "missing-xx"); err != nil || exists {
+				t.Errorf("Exists(missing-xx) after SetMany() got = %v, %v, want false", exists, err)
+			}
+		})
+	}
+}
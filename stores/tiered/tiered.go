@@ -0,0 +1,556 @@
+package kvtiered
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"iter"
+	"sync"
+	"time"
+
+	"github.com/twirapp/kv"
+	kvbus "github.com/twirapp/kv/bus"
+	kvcodec "github.com/twirapp/kv/codec"
+	kvoptions "github.com/twirapp/kv/options"
+)
+
+var _ kv.KV = (*Tiered)(nil)
+var _ kv.CodecProvider = (*Tiered)(nil)
+
+// DefaultL1TTL is the default maximum lifetime of a key in the local tier.
+const DefaultL1TTL = time.Minute
+
+// minBackfillTTL is the shortest remaining lifetime in L2 for which a key read from L2 is
+// copied to L1. Keys about to expire are served from L2 alone.
+const minBackfillTTL = time.Second
+
+// backfillWorkers caps the concurrent TTL calls made to an L2 store that does not implement
+// kv.TTLManyProvider when back-filling L1.
+const backfillWorkers = 8
+
+// WriteMode controls how writes reach the local tier.
+type WriteMode int
+
+const (
+	// WriteThrough writes values to both tiers.
+	WriteThrough WriteMode = iota
+	// WriteAround writes values to the remote tier only and evicts them from the local tier,
+	// so the local tier is filled by reads alone.
+	WriteAround
+)
+
+type Option func(*Tiered)
+
+// WithL1TTL caps the lifetime of keys in the local tier. Keys read from the remote tier are
+// kept locally for at most d, so changes made through other instances become visible after d,
+// and never longer than they have left in the remote tier. A non-positive d disables the cap.
+// Defaults to DefaultL1TTL.
+func WithL1TTL(d time.Duration) Option {
+	return func(c *Tiered) {
+		c.l1TTL = d
+	}
+}
+
+// WithWriteMode sets how writes reach the local tier. Defaults to WriteThrough.
+func WithWriteMode(mode WriteMode) Option {
+	return func(c *Tiered) {
+		c.writeMode = mode
+	}
+}
+
+// WithInvalidationBus broadcasts every write on bus and evicts keys written by other instances
+// from the local tier, so instances sharing the remote tier do not serve stale local copies.
+// Call Close to stop listening to the bus.
+func WithInvalidationBus(bus kvbus.Bus) Option {
+	return func(c *Tiered) {
+		c.bus = bus
+	}
+}
+
+// WithL1ErrorHandler sets a function called when the local tier fails to apply a write or an
+// eviction. The remote tier already holds the result by then, so the operation still succeeds;
+// keys that could not be written are evicted from the local tier instead.
+func WithL1ErrorHandler(fn func(err error)) Option {
+	return func(c *Tiered) {
+		c.onL1Error = fn
+	}
+}
+
+// WithPublishErrorHandler sets a function called when an invalidation cannot be published on the
+// bus. The write it follows has already succeeded, so it is not failed, but other instances may
+// serve their local copies of the keys until the L1 TTL evicts them.
+func WithPublishErrorHandler(fn func(msg kvbus.Invalidation, err error)) Option {
+	return func(c *Tiered) {
+		c.onPublishError = fn
+	}
+}
+
+// Tiered is a two-tier store: reads are served by a fast local L1 store when possible and
+// fall through to a shared remote L2 store, back-filling L1. L1 errors are never returned
+// from reads, the key is read from L2 instead, nor from writes, which are reported to the
+// WithL1ErrorHandler function. Writes and deletes go to both
+// tiers, L2 first. L2 is the source of truth for keys, expirations, versions and counters.
+type Tiered struct {
+	l1        kv.KV
+	l2        kv.KV
+	l1TTL     time.Duration
+	writeMode WriteMode
+	onL1Error func(err error)
+
+	bus            kvbus.Bus
+	id             string
+	unsubscribe    func()
+	onPublishError func(msg kvbus.Invalidation, err error)
+}
+
+func New(l1, l2 kv.KV, options ...Option) *Tiered {
+	c := &Tiered{
+		l1:        l1,
+		l2:        l2,
+		l1TTL:     DefaultL1TTL,
+		writeMode: WriteThrough,
+	}
+
+	for _, o := range options {
+		o(c)
+	}
+
+	if c.bus != nil {
+		c.id = newInstanceID()
+		c.unsubscribe = c.bus.Subscribe(c.evict)
+	}
+
+	return c
+}
+
+// Close stops listening to the invalidation bus. It does not close the underlying stores.
+func (c *Tiered) Close() error {
+	if c.unsubscribe != nil {
+		c.unsubscribe()
+		c.unsubscribe = nil
+	}
+
+	return nil
+}
+
+func newInstanceID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// evict removes the keys invalidated by another instance from the local tier.
+func (c *Tiered) evict(msg kvbus.Invalidation) {
+	if msg.Source == c.id {
+		return
+	}
+
+	ctx := context.Background()
+	if len(msg.Keys) > 0 {
+		if err := c.l1.DeleteMany(ctx, msg.Keys); err != nil {
+			c.l1Error(fmt.Errorf("failed to evict keys from L1: %w", err))
+		}
+	}
+	for _, pattern := range msg.Patterns {
+		if _, err := c.l1.DeleteByPattern(ctx, pattern); err != nil {
+			c.l1Error(fmt.Errorf("failed to evict pattern %s from L1: %w", pattern, err))
+		}
+	}
+}
+
+// l1Error reports a failed L1 operation to the WithL1ErrorHandler function, if there is one.
+func (c *Tiered) l1Error(err error) {
+	if c.onL1Error != nil {
+		c.onL1Error(err)
+	}
+}
+
+// l1SetFailed evicts keys from L1 after they could not be written to it, so L1 does not keep
+// serving their previous values, and reports err.
+func (c *Tiered) l1SetFailed(ctx context.Context, err error, keys ...string) {
+	if evictErr := c.l1.DeleteMany(ctx, keys); evictErr != nil {
+		err = errors.Join(err, fmt.Errorf("failed to evict keys from L1: %w", evictErr))
+	}
+
+	c.l1Error(err)
+}
+
+// publish sends msg on the invalidation bus, if there is one. Failures are reported to the
+// WithPublishErrorHandler function, since the write msg follows has already been applied.
+func (c *Tiered) publish(ctx context.Context, msg kvbus.Invalidation) {
+	if c.bus == nil {
+		return
+	}
+
+	msg.Source = c.id
+	if err := c.bus.Publish(ctx, msg); err != nil && c.onPublishError != nil {
+		c.onPublishError(msg, fmt.Errorf("failed to publish invalidation: %w", err))
+	}
+}
+
+// invalidate removes keys from the local tier of this and every other instance.
+func (c *Tiered) invalidate(ctx context.Context, keys ...string) {
+	if err := c.l1.DeleteMany(ctx, keys); err != nil {
+		c.l1Error(fmt.Errorf("failed to evict keys from L1: %w", err))
+	}
+
+	c.publish(ctx, kvbus.Invalidation{Keys: keys})
+}
+
+// Codec returns the codec of the remote tier.
+func (c *Tiered) Codec() kvcodec.Codec {
+	return kv.CodecOf(c.l2)
+}
+
+// l1Options returns the options for writing a key to L1, with its expiration capped by the L1 TTL.
+func (c *Tiered) l1Options(options ...kvoptions.Option) []kvoptions.Option {
+	expire := kvoptions.Construct(options...).Expire
+	if c.l1TTL > 0 && (expire <= 0 || expire > c.l1TTL) {
+		expire = c.l1TTL
+	}
+
+	return []kvoptions.Option{kvoptions.WithExpire(expire)}
+}
+
+func (c *Tiered) Get(ctx context.Context, key string) kv.Valuer {
+	// L1 is only a cache, so any L1 error is answered from L2.
+	v := c.l1.Get(ctx, key)
+	if v.Err() == nil {
+		return v
+	}
+
+	v = c.l2.Get(ctx, key)
+	if data, err := v.Bytes(); err == nil {
+		c.backfill(ctx, []kv.SetMany{{Key: key, Value: data}})
+	}
+
+	return v
+}
+
+// backfill copies values read from L2 to L1, with their expiration capped by the remaining
+// lifetime of each key in L2, so L1 does not outlive it. Keys about to expire or already gone
+// from L2 are skipped.
+func (c *Tiered) backfill(ctx context.Context, values []kv.SetMany) {
+	keys := make([]string, len(values))
+	for i, v := range values {
+		keys[i] = v.Key
+	}
+
+	ttls, errs := c.l2TTLs(ctx, keys)
+
+	l1Values := values[:0]
+	for i, v := range values {
+		switch {
+		case errors.Is(errs[i], kv.ErrNotSupported):
+			// The remaining lifetime is unknown, so only the L1 TTL applies.
+			v.Options = c.l1Options()
+		case errs[i] != nil:
+			continue
+		case ttls[i] == kv.NoExpiration:
+			v.Options = c.l1Options()
+		case ttls[i] < minBackfillTTL:
+			continue
+		default:
+			v.Options = c.l1Options(kvoptions.WithExpire(ttls[i]))
+		}
+
+		l1Values = append(l1Values, v)
+	}
+
+	if len(l1Values) > 0 {
+		_ = c.l1.SetMany(ctx, l1Values)
+	}
+}
+
+// l2TTLs returns the remaining lifetime of keys in L2. It makes a single TTLMany call when L2
+// implements kv.TTLManyProvider, and up to backfillWorkers concurrent TTL calls otherwise.
+func (c *Tiered) l2TTLs(ctx context.Context, keys []string) ([]time.Duration, []error) {
+	errs := make([]error, len(keys))
+
+	if p, ok := c.l2.(kv.TTLManyProvider); ok {
+		ttls, err := p.TTLMany(ctx, keys)
+		for i := range errs {
+			errs[i] = err
+		}
+		return ttls, errs
+	}
+
+	var (
+		ttls = make([]time.Duration, len(keys))
+		sem  = make(chan struct{}, backfillWorkers)
+		wg   sync.WaitGroup
+	)
+
+	for i, key := range keys {
+		sem <- struct{}{}
+		wg.Add(1)
+
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			ttls[i], errs[i] = c.l2.TTL(ctx, key)
+		}()
+	}
+
+	wg.Wait()
+
+	return ttls, errs
+}
+
+func (c *Tiered) GetMany(ctx context.Context, keys []string) []kv.Valuer {
+	results := c.l1.GetMany(ctx, keys)
+
+	var missing []int
+	for i, v := range results {
+		if v.Err() != nil {
+			missing = append(missing, i)
+		}
+	}
+	if len(missing) == 0 {
+		return results
+	}
+
+	missingKeys := make([]string, len(missing))
+	for i, idx := range missing {
+		missingKeys[i] = keys[idx]
+	}
+
+	var values []kv.SetMany
+	for i, v := range c.l2.GetMany(ctx, missingKeys) {
+		results[missing[i]] = v
+
+		if data, err := v.Bytes(); err == nil {
+			values = append(values, kv.SetMany{Key: missingKeys[i], Value: data})
+		}
+	}
+
+	if len(values) > 0 {
+		c.backfill(ctx, values)
+	}
+
+	return results
+}
+
+func (c *Tiered) Set(ctx context.Context, key string, value any, options ...kvoptions.Option) error {
+	if err := c.l2.Set(ctx, key, value, options...); err != nil {
+		return err
+	}
+
+	if c.writeMode == WriteAround {
+		c.invalidate(ctx, key)
+		return nil
+	}
+
+	if err := c.l1.Set(ctx, key, value, c.l1Options(options...)...); err != nil {
+		c.l1SetFailed(ctx, fmt.Errorf("failed to set key %s in L1: %w", key, err), key)
+	}
+
+	c.publish(ctx, kvbus.Invalidation{Keys: []string{key}})
+
+	return nil
+}
+
+func (c *Tiered) SetMany(ctx context.Context, values []kv.SetMany) error {
+	keys := make([]string, len(values))
+	for i, v := range values {
+		keys[i] = v.Key
+	}
+
+	if err := c.l2.SetMany(ctx, values); err != nil {
+		// Some of the values may have been written, so the local copies of all keys are evicted.
+		c.invalidate(ctx, keys...)
+		return err
+	}
+
+	if c.writeMode == WriteAround {
+		c.invalidate(ctx, keys...)
+		return nil
+	}
+
+	l1Values := make([]kv.SetMany, len(values))
+	for i, v := range values {
+		l1Values[i] = kv.SetMany{Key: v.Key, Value: v.Value, Options: c.l1Options(v.Options...)}
+	}
+
+	if err := c.l1.SetMany(ctx, l1Values); err != nil {
+		c.l1SetFailed(ctx, fmt.Errorf("failed to set keys in L1: %w", err), keys...)
+	}
+
+	c.publish(ctx, kvbus.Invalidation{Keys: keys})
+
+	return nil
+}
+
+func (c *Tiered) Delete(ctx context.Context, key string) error {
+	if err := c.l2.Delete(ctx, key); err != nil {
+		return err
+	}
+
+	c.invalidate(ctx, key)
+
+	return nil
+}
+
+func (c *Tiered) DeleteMany(ctx context.Context, keys []string) error {
+	if err := c.l2.DeleteMany(ctx, keys); err != nil {
+		return err
+	}
+
+	c.invalidate(ctx, keys...)
+
+	return nil
+}
+
+func (c *Tiered) Exists(ctx context.Context, key string) (bool, error) {
+	if exists, err := c.l1.Exists(ctx, key); err == nil && exists {
+		return true, nil
+	}
+
+	return c.l2.Exists(ctx, key)
+}
+
+func (c *Tiered) ExistsMany(ctx context.Context, keys []string) ([]bool, error) {
+	results, err := c.l1.ExistsMany(ctx, keys)
+	if err != nil {
+		return c.l2.ExistsMany(ctx, keys)
+	}
+
+	var missing []int
+	for i, exists := range results {
+		if !exists {
+			missing = append(missing, i)
+		}
+	}
+	if len(missing) == 0 {
+		return results, nil
+	}
+
+	missingKeys := make([]string, len(missing))
+	for i, idx := range missing {
+		missingKeys[i] = keys[idx]
+	}
+
+	l2Results, err := c.l2.ExistsMany(ctx, missingKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, exists := range l2Results {
+		results[missing[i]] = exists
+	}
+
+	return results, nil
+}
+
+func (c *Tiered) GetKeysByPattern(ctx context.Context, pattern string) ([]string, error) {
+	return c.l2.GetKeysByPattern(ctx, pattern)
+}
+
+func (c *Tiered) ScanKeys(ctx context.Context, pattern string) iter.Seq2[string, error] {
+	return c.l2.ScanKeys(ctx, pattern)
+}
+
+func (c *Tiered) DeleteByPattern(ctx context.Context, pattern string) (int64, error) {
+	deleted, err := c.l2.DeleteByPattern(ctx, pattern)
+	if err != nil {
+		return deleted, err
+	}
+
+	if _, err := c.l1.DeleteByPattern(ctx, pattern); err != nil {
+		c.l1Error(fmt.Errorf("failed to evict pattern %s from L1: %w", pattern, err))
+	}
+
+	c.publish(ctx, kvbus.Invalidation{Patterns: []string{pattern}})
+
+	return deleted, nil
+}
+
+func (c *Tiered) Incr(ctx context.Context, key string, options ...kvoptions.Option) (int64, error) {
+	return c.IncrBy(ctx, key, 1, options...)
+}
+
+func (c *Tiered) IncrBy(ctx context.Context, key string, delta int64, options ...kvoptions.Option) (int64, error) {
+	result, err := c.l2.IncrBy(ctx, key, delta, options...)
+	if err != nil {
+		return 0, err
+	}
+
+	c.invalidate(ctx, key)
+
+	return result, nil
+}
+
+func (c *Tiered) IncrByFloat(ctx context.Context, key string, delta float64, options ...kvoptions.Option) (float64, error) {
+	result, err := c.l2.IncrByFloat(ctx, key, delta, options...)
+	if err != nil {
+		return 0, err
+	}
+
+	c.invalidate(ctx, key)
+
+	return result, nil
+}
+
+func (c *Tiered) Decr(ctx context.Context, key string, options ...kvoptions.Option) (int64, error) {
+	return c.IncrBy(ctx, key, -1, options...)
+}
+
+func (c *Tiered) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return c.l2.TTL(ctx, key)
+}
+
+func (c *Tiered) Expire(ctx context.Context, key string, d time.Duration) error {
+	if err := c.l2.Expire(ctx, key, d); err != nil {
+		return err
+	}
+
+	c.invalidate(ctx, key)
+
+	return nil
+}
+
+func (c *Tiered) ExpireAt(ctx context.Context, key string, t time.Time) error {
+	if err := c.l2.ExpireAt(ctx, key, t); err != nil {
+		return err
+	}
+
+	c.invalidate(ctx, key)
+
+	return nil
+}
+
+func (c *Tiered) Persist(ctx context.Context, key string) error {
+	if err := c.l2.Persist(ctx, key); err != nil {
+		return err
+	}
+
+	c.invalidate(ctx, key)
+
+	return nil
+}
+
+// GetWithVersion reads from L2, since versions are only meaningful in the store that issued them.
+func (c *Tiered) GetWithVersion(ctx context.Context, key string) (kv.Valuer, kv.Version) {
+	return c.l2.GetWithVersion(ctx, key)
+}
+
+func (c *Tiered) CompareAndSwap(
+	ctx context.Context,
+	key string,
+	version kv.Version,
+	value any,
+	options ...kvoptions.Option,
+) error {
+	if err := c.l2.CompareAndSwap(ctx, key, version, value, options...); err != nil {
+		return err
+	}
+
+	c.invalidate(ctx, key)
+
+	return nil
+}
@@ -0,0 +1,458 @@
+package kvtiered
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/twirapp/kv"
+	kvbus "github.com/twirapp/kv/bus"
+	kvoptions "github.com/twirapp/kv/options"
+	kvinmemory "github.com/twirapp/kv/stores/inmemory"
+	kvotter "github.com/twirapp/kv/stores/otter"
+	kvvaluer "github.com/twirapp/kv/valuer"
+)
+
+func TestTiered_Backfill(t *testing.T) {
+	t.Parallel()
+
+	l1, l2 := kvotter.New(), kvinmemory.New()
+	c := New(l1, l2, WithL1TTL(time.Minute))
+	ctx := context.Background()
+
+	if err := l2.Set(ctx, "key1", "value1"); err != nil {
+		t.Fatalf("Set() L2 error = %v", err)
+	}
+	if err := l2.Set(ctx, "key2", "value2", kvoptions.WithExpire(time.Hour)); err != nil {
+		t.Fatalf("Set() L2 error = %v", err)
+	}
+
+	if got, err := c.Get(ctx, "key1").String(); err != nil || got != "value1" {
+		t.Errorf("Get() got = %v, %v, want value1", got, err)
+	}
+
+	results := c.GetMany(ctx, []string{"key1", "key2", "missing"})
+	if got, err := results[1].String(); err != nil || got != "value2" {
+		t.Errorf("GetMany()[1] got = %v, %v, want value2", got, err)
+	}
+	if err := results[2].Err(); !errors.Is(err, kv.ErrKeyNil) {
+		t.Errorf("GetMany()[2] error = %v, want %v", err, kv.ErrKeyNil)
+	}
+
+	for _, key := range []string{"key1", "key2"} {
+		ttl, err := l1.TTL(ctx, key)
+		if err != nil || ttl <= 0 || ttl > time.Minute {
+			t.Errorf("TTL() L1 %s got = %v, %v, want up to %v", key, ttl, err, time.Minute)
+		}
+	}
+
+	if exists, err := l1.Exists(ctx, "missing"); err != nil || exists {
+		t.Errorf("Exists() L1 missing got = %v, %v, want false", exists, err)
+	}
+}
+
+func TestTiered_BackfillCappedByL2TTL(t *testing.T) {
+	t.Parallel()
+
+	for _, l1TTL := range []time.Duration{time.Minute, 0} {
+		l1, l2 := kvotter.New(), kvinmemory.New()
+		c := New(l1, l2, WithL1TTL(l1TTL))
+		ctx := context.Background()
+
+		if err := l2.Set(ctx, "short", "value", kvoptions.WithExpire(5*time.Second)); err != nil {
+			t.Fatalf("Set() L2 error = %v", err)
+		}
+		if err := l2.Set(ctx, "expiring", "value", kvoptions.WithExpire(100*time.Millisecond)); err != nil {
+			t.Fatalf("Set() L2 error = %v", err)
+		}
+
+		if got, err := c.Get(ctx, "short").String(); err != nil || got != "value" {
+			t.Errorf("Get() L1 TTL %v got = %v, %v, want value", l1TTL, got, err)
+		}
+		results := c.GetMany(ctx, []string{"expiring"})
+		if got, err := results[0].String(); err != nil || got != "value" {
+			t.Errorf("GetMany() L1 TTL %v got = %v, %v, want value", l1TTL, got, err)
+		}
+
+		if ttl, err := l1.TTL(ctx, "short"); err != nil || ttl <= 0 || ttl > 5*time.Second {
+			t.Errorf("TTL() L1 TTL %v short got = %v, %v, want up to %v", l1TTL, ttl, err, 5*time.Second)
+		}
+
+		// Keys about to expire in L2 are not copied to L1.
+		if exists, err := l1.Exists(ctx, "expiring"); err != nil || exists {
+			t.Errorf("Exists() L1 TTL %v expiring got = %v, %v, want false", l1TTL, exists, err)
+		}
+	}
+}
+
+// countingStore counts the TTL lookups made against the wrapped store.
+type countingStore struct {
+	kv.KV
+	ttl, ttlMany, running, peak atomic.Int32
+}
+
+func (s *countingStore) TTL(ctx context.Context, key string) (time.Duration, error) {
+	s.ttl.Add(1)
+
+	n := s.running.Add(1)
+	defer s.running.Add(-1)
+	for {
+		p := s.peak.Load()
+		if n <= p || s.peak.CompareAndSwap(p, n) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond)
+
+	return s.KV.TTL(ctx, key)
+}
+
+// batchStore also looks up TTLs in batches.
+type batchStore struct {
+	countingStore
+}
+
+func (s *batchStore) TTLMany(ctx context.Context, keys []string) ([]time.Duration, error) {
+	s.ttlMany.Add(1)
+	return s.KV.(kv.TTLManyProvider).TTLMany(ctx, keys)
+}
+
+func TestTiered_BackfillTTLLookups(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	keys := make([]string, 100)
+
+	newL2 := func() *kvinmemory.InMemory {
+		l2 := kvinmemory.New()
+		for i := range keys {
+			keys[i] = fmt.Sprintf("key%d", i)
+			if err := l2.Set(ctx, keys[i], "value", kvoptions.WithExpire(time.Hour)); err != nil {
+				t.Fatalf("Set() L2 error = %v", err)
+			}
+		}
+		return l2
+	}
+
+	batch := &batchStore{countingStore{KV: newL2()}}
+	l1 := kvotter.New()
+	New(l1, batch).GetMany(ctx, keys)
+
+	if got := batch.ttlMany.Load(); got != 1 {
+		t.Errorf("GetMany() TTLMany calls = %d, want 1", got)
+	}
+	if got := batch.ttl.Load(); got != 0 {
+		t.Errorf("GetMany() TTL calls = %d, want 0", got)
+	}
+	if exists, err := l1.ExistsMany(ctx, keys); err != nil || slices.Contains(exists, false) {
+		t.Errorf("ExistsMany() L1 got = %v, %v, want all backfilled", exists, err)
+	}
+
+	single := &countingStore{KV: newL2()}
+	l1 = kvotter.New()
+	New(l1, single).GetMany(ctx, keys)
+
+	if got := single.ttl.Load(); got != int32(len(keys)) {
+		t.Errorf("GetMany() TTL calls = %d, want %d", got, len(keys))
+	}
+	if got := single.peak.Load(); got > backfillWorkers {
+		t.Errorf("GetMany() concurrent TTL calls = %d, want at most %d", got, backfillWorkers)
+	}
+	if exists, err := l1.ExistsMany(ctx, keys); err != nil || slices.Contains(exists, false) {
+		t.Errorf("ExistsMany() L1 got = %v, %v, want all backfilled", exists, err)
+	}
+}
+
+var errBroken = errors.New("broken store")
+
+// brokenStore fails every operation it overrides with errBroken.
+type brokenStore struct {
+	kv.KV
+}
+
+func (s brokenStore) Get(context.Context, string) kv.Valuer {
+	return &kvvaluer.Valuer{Error: errBroken}
+}
+
+func (s brokenStore) GetMany(_ context.Context, keys []string) []kv.Valuer {
+	results := make([]kv.Valuer, len(keys))
+	for i := range results {
+		results[i] = &kvvaluer.Valuer{Error: errBroken}
+	}
+	return results
+}
+
+func (s brokenStore) Exists(context.Context, string) (bool, error) {
+	return false, errBroken
+}
+
+func (s brokenStore) ExistsMany(context.Context, []string) ([]bool, error) {
+	return nil, errBroken
+}
+
+func TestTiered_L1ReadErrors(t *testing.T) {
+	t.Parallel()
+
+	l2 := kvinmemory.New()
+	c := New(brokenStore{kvotter.New()}, l2)
+	ctx := context.Background()
+
+	if err := l2.Set(ctx, "key", "value"); err != nil {
+		t.Fatalf("Set() L2 error = %v", err)
+	}
+
+	if got, err := c.Get(ctx, "key").String(); err != nil || got != "value" {
+		t.Errorf("Get() got = %v, %v, want value", got, err)
+	}
+
+	results := c.GetMany(ctx, []string{"key", "missing"})
+	if got, err := results[0].String(); err != nil || got != "value" {
+		t.Errorf("GetMany()[0] got = %v, %v, want value", got, err)
+	}
+	if err := results[1].Err(); !errors.Is(err, kv.ErrKeyNil) {
+		t.Errorf("GetMany()[1] error = %v, want %v", err, kv.ErrKeyNil)
+	}
+
+	if exists, err := c.Exists(ctx, "key"); err != nil || !exists {
+		t.Errorf("Exists() got = %v, %v, want true", exists, err)
+	}
+	if exists, err := c.ExistsMany(ctx, []string{"key", "missing"}); err != nil || !slices.Equal(exists, []bool{true, false}) {
+		t.Errorf("ExistsMany() got = %v, %v, want [true false]", exists, err)
+	}
+}
+
+// readOnlyStore fails every write with errBroken, but still deletes keys.
+type readOnlyStore struct {
+	kv.KV
+}
+
+func (s readOnlyStore) Set(context.Context, string, any, ...kvoptions.Option) error {
+	return errBroken
+}
+
+func (s readOnlyStore) SetMany(context.Context, []kv.SetMany) error {
+	return errBroken
+}
+
+func TestTiered_L1WriteErrors(t *testing.T) {
+	t.Parallel()
+
+	l1, l2 := kvotter.New(), kvinmemory.New()
+	ctx := context.Background()
+
+	var reported []error
+	c := New(readOnlyStore{l1}, l2, WithL1ErrorHandler(func(err error) {
+		reported = append(reported, err)
+	}))
+
+	for _, key := range []string{"key1", "key2"} {
+		if err := l1.Set(ctx, key, "old"); err != nil {
+			t.Fatalf("Set() L1 error = %v", err)
+		}
+	}
+
+	// The write reached L2, so it succeeds and the stale local copy is evicted.
+	if err := c.Set(ctx, "key1", "new"); err != nil {
+		t.Errorf("Set() error = %v, want nil", err)
+	}
+	if err := c.SetMany(ctx, []kv.SetMany{{Key: "key2", Value: "new"}}); err != nil {
+		t.Errorf("SetMany() error = %v, want nil", err)
+	}
+
+	for _, key := range []string{"key1", "key2"} {
+		if exists, err := l1.Exists(ctx, key); err != nil || exists {
+			t.Errorf("Exists() L1 %s got = %v, %v, want false", key, exists, err)
+		}
+		if got, err := c.Get(ctx, key).String(); err != nil || got != "new" {
+			t.Errorf("Get() %s got = %v, %v, want new", key, got, err)
+		}
+	}
+
+	if len(reported) != 2 || !errors.Is(reported[0], errBroken) || !errors.Is(reported[1], errBroken) {
+		t.Errorf("WithL1ErrorHandler() reported = %v, want 2 errors matching %v", reported, errBroken)
+	}
+}
+
+// brokenBus fails every publish with errBroken.
+type brokenBus struct {
+	*kvbus.LocalBus
+}
+
+func (b brokenBus) Publish(context.Context, kvbus.Invalidation) error {
+	return errBroken
+}
+
+func TestTiered_PublishErrors(t *testing.T) {
+	t.Parallel()
+
+	l2 := kvinmemory.New()
+	ctx := context.Background()
+
+	var reported []kvbus.Invalidation
+	c := New(kvotter.New(), l2, WithInvalidationBus(brokenBus{kvbus.NewLocalBus()}), WithPublishErrorHandler(
+		func(msg kvbus.Invalidation, err error) {
+			if !errors.Is(err, errBroken) {
+				t.Errorf("WithPublishErrorHandler() error = %v, want %v", err, errBroken)
+			}
+			reported = append(reported, msg)
+		},
+	))
+	defer c.Close()
+
+	// The counter is applied once, so a caller does not retry and count twice.
+	if got, err := c.Incr(ctx, "counter"); err != nil || got != 1 {
+		t.Errorf("Incr() got = %v, %v, want 1", got, err)
+	}
+	if err := c.Set(ctx, "key", "value"); err != nil {
+		t.Errorf("Set() error = %v, want nil", err)
+	}
+	if got, err := l2.Get(ctx, "counter").Int(); err != nil || got != 1 {
+		t.Errorf("Get() L2 counter got = %v, %v, want 1", got, err)
+	}
+
+	if len(reported) != 2 || !slices.Equal(reported[0].Keys, []string{"counter"}) || !slices.Equal(reported[1].Keys, []string{"key"}) {
+		t.Errorf("WithPublishErrorHandler() reported = %v, want counter and key", reported)
+	}
+}
+
+func TestTiered_WriteThrough(t *testing.T) {
+	t.Parallel()
+
+	l1, l2 := kvotter.New(), kvinmemory.New()
+	c := New(l1, l2, WithL1TTL(time.Minute))
+	ctx := context.Background()
+
+	if err := c.Set(ctx, "short", "value", kvoptions.WithExpire(time.Second)); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := c.Set(ctx, "long", "value"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	if ttl, err := l1.TTL(ctx, "short"); err != nil || ttl <= 0 || ttl > time.Second {
+		t.Errorf("TTL() L1 short got = %v, %v, want up to %v", ttl, err, time.Second)
+	}
+	if ttl, err := l1.TTL(ctx, "long"); err != nil || ttl <= 0 || ttl > time.Minute {
+		t.Errorf("TTL() L1 long got = %v, %v, want up to %v", ttl, err, time.Minute)
+	}
+	if ttl, err := l2.TTL(ctx, "long"); err != nil || ttl != kv.NoExpiration {
+		t.Errorf("TTL() L2 long got = %v, %v, want %v", ttl, err, kv.NoExpiration)
+	}
+
+	if err := c.Delete(ctx, "long"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	for name, store := range map[string]kv.KV{"L1": l1, "L2": l2} {
+		if exists, err := store.Exists(ctx, "long"); err != nil || exists {
+			t.Errorf("Exists() %s after Delete() got = %v, %v, want false", name, exists, err)
+		}
+	}
+}
+
+func TestTiered_WriteAround(t *testing.T) {
+	t.Parallel()
+
+	l1, l2 := kvotter.New(), kvinmemory.New()
+	c := New(l1, l2, WithWriteMode(WriteAround))
+	ctx := context.Background()
+
+	if err := l1.Set(ctx, "key", "old"); err != nil {
+		t.Fatalf("Set() L1 error = %v", err)
+	}
+
+	if err := c.Set(ctx, "key", "new"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	if exists, err := l1.Exists(ctx, "key"); err != nil || exists {
+		t.Errorf("Exists() L1 after Set() got = %v, %v, want false", exists, err)
+	}
+
+	if got, err := c.Get(ctx, "key").String(); err != nil || got != "new" {
+		t.Errorf("Get() got = %v, %v, want new", got, err)
+	}
+
+	if got, err := l1.Get(ctx, "key").String(); err != nil || got != "new" {
+		t.Errorf("Get() L1 after read got = %v, %v, want new", got, err)
+	}
+}
+
+func TestTiered_CountersInvalidateL1(t *testing.T) {
+	t.Parallel()
+
+	l1, l2 := kvotter.New(), kvinmemory.New()
+	c := New(l1, l2)
+	ctx := context.Background()
+
+	if err := c.Set(ctx, "counter", 1); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if got, err := c.Incr(ctx, "counter"); err != nil || got != 2 {
+		t.Fatalf("Incr() got = %v, %v, want 2", got, err)
+	}
+
+	if got, err := c.Get(ctx, "counter").Int(); err != nil || got != 2 {
+		t.Errorf("Get() after Incr() got = %v, %v, want 2", got, err)
+	}
+}
+
+func TestTiered_InvalidationBus(t *testing.T) {
+	t.Parallel()
+
+	bus := kvbus.NewLocalBus()
+	l2 := kvinmemory.New()
+	ctx := context.Background()
+
+	l1a, l1b := kvotter.New(), kvotter.New()
+	a := New(l1a, l2, WithInvalidationBus(bus))
+	b := New(l1b, l2, WithInvalidationBus(bus))
+	defer a.Close()
+	defer b.Close()
+
+	if err := a.Set(ctx, "key", "old"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if got, err := b.Get(ctx, "key").String(); err != nil || got != "old" {
+		t.Fatalf("Get() got = %v, %v, want old", got, err)
+	}
+
+	if err := a.Set(ctx, "key", "new"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	// The writer keeps its own local copy, the other instance evicts it.
+	if got, err := l1a.Get(ctx, "key").String(); err != nil || got != "new" {
+		t.Errorf("Get() writer L1 got = %v, %v, want new", got, err)
+	}
+	if got, err := b.Get(ctx, "key").String(); err != nil || got != "new" {
+		t.Errorf("Get() after remote Set() got = %v, %v, want new", got, err)
+	}
+
+	if err := b.Set(ctx, "user:1", "value"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if _, err := a.Get(ctx, "user:1").String(); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if _, err := b.DeleteByPattern(ctx, "user:*"); err != nil {
+		t.Fatalf("DeleteByPattern() error = %v", err)
+	}
+	if exists, err := l1a.Exists(ctx, "user:1"); err != nil || exists {
+		t.Errorf("Exists() L1 after remote DeleteByPattern() got = %v, %v, want false", exists, err)
+	}
+
+	// After Close the instance no longer receives invalidations.
+	if err := b.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err := a.Set(ctx, "key", "newer"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if got, err := l1b.Get(ctx, "key").String(); err != nil || got != "new" {
+		t.Errorf("Get() L1 after Close() got = %v, %v, want new", got, err)
+	}
+}
@@ -0,0 +1,87 @@
+package valkey
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	kvbus "github.com/twirapp/kv/bus"
+	"github.com/twirapp/kv/internal/backoff"
+	"github.com/valkey-io/valkey-go"
+)
+
+var _ kvbus.Bus = (*InvalidationBus)(nil)
+
+// InvalidationBus is a kvbus.Bus over Valkey pub/sub.
+//
+// The subscription is restarted with a backoff whenever the connection fails. Messages
+// published while disconnected are lost, so subscribers receive kvbus.InvalidateAll
+// after every resubscription.
+type InvalidationBus struct {
+	cl      valkey.Client
+	channel string
+}
+
+func NewInvalidationBus(client valkey.Client, channel string) *InvalidationBus {
+	return &InvalidationBus{
+		cl:      client,
+		channel: channel,
+	}
+}
+
+func (b *InvalidationBus) Publish(ctx context.Context, msg kvbus.Invalidation) error {
+	data, err := msg.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	return b.cl.Do(ctx, b.cl.B().Publish().Channel(b.channel).Message(string(data)).Build()).Error()
+}
+
+func (b *InvalidationBus) Subscribe(handler func(kvbus.Invalidation)) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		retry := backoff.Backoff{Min: 100 * time.Millisecond, Max: 5 * time.Second}
+
+		var subscribed atomic.Bool
+		hookCtx := valkey.WithOnSubscriptionHook(ctx, func(s valkey.PubSubSubscription) {
+			if s.Kind != "subscribe" {
+				return
+			}
+			if subscribed.Swap(true) {
+				handler(kvbus.InvalidateAll())
+			}
+		})
+
+		for {
+			started := time.Now()
+			err := b.cl.Receive(hookCtx, b.cl.B().Subscribe().Channel(b.channel).Build(), func(m valkey.PubSubMessage) {
+				var inv kvbus.Invalidation
+				if err := inv.UnmarshalBinary([]byte(m.Message)); err == nil {
+					handler(inv)
+				}
+			})
+			if ctx.Err() != nil || errors.Is(err, valkey.ErrClosing) {
+				return
+			}
+
+			// A subscription that lasted a while failed on a healthy connection, so start over.
+			if time.Since(started) > retry.Max {
+				retry.Reset()
+			}
+			if !retry.Wait(ctx) {
+				return
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
@@ -2,31 +2,73 @@ package valkey
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"iter"
 	"sync"
+	"time"
 
 	"github.com/twirapp/kv"
-	"github.com/twirapp/kv/internal/tobytes"
+	kvcodec "github.com/twirapp/kv/codec"
+	"github.com/twirapp/kv/internal/valueversion"
 	kvoptions "github.com/twirapp/kv/options"
 	kvvaluer "github.com/twirapp/kv/valuer"
 	glide "github.com/valkey-io/valkey-glide/go/v2"
-	"github.com/valkey-io/valkey-glide/go/v2/constants"
 	"github.com/valkey-io/valkey-glide/go/v2/models"
 	"github.com/valkey-io/valkey-glide/go/v2/options"
+	"github.com/valkey-io/valkey-glide/go/v2/pipeline"
 )
 
 var _ kv.KV = (*GlideStore)(nil)
+var _ kv.CodecProvider = (*GlideStore)(nil)
 
-func NewGlide(client *glide.Client) *GlideStore {
+func NewGlide(client *glide.Client, options ...Option) *GlideStore {
 	return &GlideStore{
-		cl: client,
+		glideCommon: glideCommon{
+			cl:   client,
+			opts: constructOptions(options...),
+		},
+		client: client,
 	}
 }
 
 type GlideStore struct {
-	cl *glide.Client
+	glideCommon
+	client *glide.Client
 }
 
-func (c *GlideStore) Get(ctx context.Context, key string) kv.Valuer {
+// glideClient lists the commands shared by the standalone and the cluster glide clients.
+type glideClient interface {
+	Get(ctx context.Context, key string) (models.Result[string], error)
+	MGet(ctx context.Context, keys []string) ([]models.Result[string], error)
+	SetWithOptions(ctx context.Context, key string, value string, options options.SetOptions) (models.Result[string], error)
+	MSet(ctx context.Context, keyValueMap map[string]string) (string, error)
+	Del(ctx context.Context, keys []string) (int64, error)
+	Unlink(ctx context.Context, keys []string) (int64, error)
+	Exists(ctx context.Context, keys []string) (int64, error)
+	Expire(ctx context.Context, key string, expireTime time.Duration) (bool, error)
+	PExpire(ctx context.Context, key string, expireTime time.Duration) (bool, error)
+	PExpireAt(ctx context.Context, key string, expireTime time.Time) (bool, error)
+	Persist(ctx context.Context, key string) (bool, error)
+	PTTL(ctx context.Context, key string) (int64, error)
+	IncrBy(ctx context.Context, key string, amount int64) (int64, error)
+	IncrByFloat(ctx context.Context, key string, amount float64) (float64, error)
+	InvokeScriptWithOptions(ctx context.Context, script options.Script, scriptOptions options.ScriptOptions) (any, error)
+}
+
+// glideCommon implements the operations that work the same way on the standalone and the
+// cluster glide clients. The cluster client splits multi-key commands by hash slot itself.
+type glideCommon struct {
+	cl   glideClient
+	opts storeOptions
+}
+
+// Codec returns the codec used to encode values.
+func (c *glideCommon) Codec() kvcodec.Codec {
+	return c.opts.codec
+}
+
+func (c *glideCommon) Get(ctx context.Context, key string) kv.Valuer {
 	result, err := c.cl.Get(ctx, key)
 	if err != nil {
 		return &kvvaluer.Valuer{Error: err}
@@ -38,33 +80,79 @@ func (c *GlideStore) Get(ctx context.Context, key string) kv.Valuer {
 	return &kvvaluer.Valuer{Value: []byte(result.Value())}
 }
 
-func (c *GlideStore) Set(ctx context.Context, key string, value any, options ...kvoptions.Option) error {
+func (c *glideCommon) GetMany(ctx context.Context, keys []string) []kv.Valuer {
+	results := make([]kv.Valuer, len(keys))
+	if len(keys) == 0 {
+		return results
+	}
+
+	values, err := c.cl.MGet(ctx, keys)
+	if err != nil {
+		for i := range results {
+			results[i] = &kvvaluer.Valuer{Error: err}
+		}
+		return results
+	}
+
+	for i, v := range values {
+		if v.IsNil() {
+			results[i] = &kvvaluer.Valuer{Error: kv.ErrKeyNil}
+			continue
+		}
+
+		results[i] = &kvvaluer.Valuer{Value: []byte(v.Value())}
+	}
+
+	return results
+}
+
+func (c *glideCommon) Set(ctx context.Context, key string, value any, options ...kvoptions.Option) error {
 	o := kvoptions.Construct(options...)
 
-	bytes, err := tobytes.ToBytes(value)
+	bytes, err := c.opts.codec.Marshal(value)
 	if err != nil {
 		return err
 	}
 
-	_, err = c.cl.Set(ctx, key, string(bytes))
+	result, err := c.cl.SetWithOptions(ctx, key, string(bytes), *newSetOptions(o))
 	if err != nil {
 		return err
 	}
+	if result.IsNil() {
+		return kv.ErrNotSet
+	}
+
+	return nil
+}
 
+func newSetOptions(o kvoptions.Options) *options.SetOptions {
+	setOpts := options.NewSetOptions()
+	switch {
+	case o.OnlyIfNotExists:
+		setOpts.SetOnlyIfDoesNotExist()
+	case o.OnlyIfExists:
+		setOpts.SetOnlyIfExists()
+	}
 	if o.Expire > 0 {
-		_, err = c.cl.Expire(ctx, key, o.Expire)
-		if err != nil {
-			return err
-		}
+		setOpts.SetExpiry(options.NewExpiryIn(roundUpMs(o.Expire)))
 	}
 
-	return err
+	return setOpts
 }
 
-func (c *GlideStore) SetMany(ctx context.Context, values []kv.SetMany) error {
+// SetMany writes all values with a single MSET, unless a value has a condition, in which case
+// every value is set on its own. Conditional writes attempt every value and return the errors
+// of all failed keys joined together, including kv.ErrNotSet for unmet conditions.
+func (c *glideCommon) SetMany(ctx context.Context, values []kv.SetMany) error {
+	for _, v := range values {
+		if o := kvoptions.Construct(v.Options...); o.OnlyIfNotExists || o.OnlyIfExists {
+			return c.setEach(ctx, values)
+		}
+	}
+
 	setMap := make(map[string]string, len(values))
 	for _, v := range values {
-		bytes, err := tobytes.ToBytes(v.Value)
+		bytes, err := c.opts.codec.Marshal(v.Value)
 		if err != nil {
 			return err
 		}
@@ -79,7 +167,7 @@ func (c *GlideStore) SetMany(ctx context.Context, values []kv.SetMany) error {
 	for _, v := range values {
 		o := kvoptions.Construct(v.Options...)
 		if o.Expire > 0 {
-			_, err = c.cl.Expire(ctx, v.Key, o.Expire)
+			_, err = c.cl.PExpire(ctx, v.Key, roundUpMs(o.Expire))
 			if err != nil {
 				return err
 			}
@@ -89,17 +177,29 @@ func (c *GlideStore) SetMany(ctx context.Context, values []kv.SetMany) error {
 	return nil
 }
 
-func (c *GlideStore) Delete(ctx context.Context, key string) error {
+func (c *glideCommon) setEach(ctx context.Context, values []kv.SetMany) error {
+	var errs []error
+
+	for _, v := range values {
+		if err := c.Set(ctx, v.Key, v.Value, v.Options...); err != nil {
+			errs = append(errs, fmt.Errorf("failed to set key %s: %w", v.Key, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c *glideCommon) Delete(ctx context.Context, key string) error {
 	_, err := c.cl.Del(ctx, []string{key})
 	return err
 }
 
-func (c *GlideStore) DeleteMany(ctx context.Context, keys []string) error {
+func (c *glideCommon) DeleteMany(ctx context.Context, keys []string) error {
 	_, err := c.cl.Del(ctx, keys)
 	return err
 }
 
-func (c *GlideStore) Exists(ctx context.Context, key string) (bool, error) {
+func (c *glideCommon) Exists(ctx context.Context, key string) (bool, error) {
 	result, err := c.cl.Exists(ctx, []string{key})
 	if err != nil {
 		return false, err
@@ -108,7 +208,7 @@ func (c *GlideStore) Exists(ctx context.Context, key string) (bool, error) {
 	return result == 1, nil
 }
 
-func (c *GlideStore) ExistsMany(ctx context.Context, keys []string) ([]bool, error) {
+func (c *glideCommon) ExistsMany(ctx context.Context, keys []string) ([]bool, error) {
 	var (
 		results = make([]bool, len(keys))
 		wg      sync.WaitGroup
@@ -133,11 +233,237 @@ func (c *GlideStore) ExistsMany(ctx context.Context, keys []string) ([]bool, err
 }
 
 func (c *GlideStore) GetKeysByPattern(ctx context.Context, pattern string) ([]string, error) {
-	opts := options.NewScanOptions().SetMatch(pattern).SetType(constants.ObjectTypeString)
-	result, err := c.cl.ScanWithOptions(ctx, models.NewCursor(), *opts)
+	return collectKeys(c.ScanKeys(ctx, pattern))
+}
+
+func (c *GlideStore) ScanKeys(ctx context.Context, pattern string) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		opts := options.NewScanOptions().SetMatch(pattern)
+		if c.opts.scanCount > 0 {
+			opts.SetCount(c.opts.scanCount)
+		}
+
+		for cursor := models.NewCursor(); !cursor.IsFinished(); {
+			if err := ctx.Err(); err != nil {
+				yield("", err)
+				return
+			}
+
+			result, err := c.client.ScanWithOptions(ctx, cursor, *opts)
+			if err != nil {
+				yield("", err)
+				return
+			}
+
+			for _, key := range result.Data {
+				if !yield(key, nil) {
+					return
+				}
+			}
+
+			cursor = result.Cursor
+		}
+	}
+}
+
+func (c *GlideStore) DeleteByPattern(ctx context.Context, pattern string) (int64, error) {
+	return deleteByPattern(c.ScanKeys(ctx, pattern), func(keys []string) (int64, error) {
+		return c.cl.Unlink(ctx, keys)
+	})
+}
+
+func (c *GlideStore) Incr(ctx context.Context, key string, options ...kvoptions.Option) (int64, error) {
+	return c.IncrBy(ctx, key, 1, options...)
+}
+
+func (c *GlideStore) IncrBy(ctx context.Context, key string, delta int64, options ...kvoptions.Option) (int64, error) {
+	o := kvoptions.Construct(options...)
+	if o.Expire <= 0 {
+		return c.cl.IncrBy(ctx, key, delta)
+	}
+
+	batch := pipeline.NewStandaloneBatch(true)
+	addCounterInit(&batch.BaseBatch, key, o.Expire)
+	batch.IncrBy(key, delta)
+
+	result, err := c.client.Exec(ctx, *batch, true)
+	if err != nil {
+		return 0, err
+	}
+
+	return lastResult[int64](result, key)
+}
+
+func (c *GlideStore) IncrByFloat(
+	ctx context.Context,
+	key string,
+	delta float64,
+	options ...kvoptions.Option,
+) (float64, error) {
+	o := kvoptions.Construct(options...)
+	if o.Expire <= 0 {
+		return c.cl.IncrByFloat(ctx, key, delta)
+	}
+
+	batch := pipeline.NewStandaloneBatch(true)
+	addCounterInit(&batch.BaseBatch, key, o.Expire)
+	batch.IncrByFloat(key, delta)
+
+	result, err := c.client.Exec(ctx, *batch, true)
+	if err != nil {
+		return 0, err
+	}
+
+	return lastResult[float64](result, key)
+}
+
+func (c *GlideStore) Decr(ctx context.Context, key string, options ...kvoptions.Option) (int64, error) {
+	return c.IncrBy(ctx, key, -1, options...)
+}
+
+// roundUpMs rounds a positive d up to whole milliseconds, since glide truncates expirations to
+// milliseconds and a zero expiration is rejected or deletes the key.
+func roundUpMs(d time.Duration) time.Duration {
+	return time.Duration(valueversion.Milliseconds(d)) * time.Millisecond
+}
+
+// addCounterInit adds a command to an atomic batch that creates key with the given expiration
+// if it does not exist yet, so the TTL is applied only on creation.
+func addCounterInit[T pipeline.StandaloneBatch | pipeline.ClusterBatch](
+	batch *pipeline.BaseBatch[T],
+	key string,
+	expire time.Duration,
+) {
+	setOpts := options.NewSetOptions().
+		SetOnlyIfDoesNotExist().
+		SetExpiry(options.NewExpiryIn(roundUpMs(expire)))
+
+	batch.SetWithOptions(key, "0", *setOpts)
+}
+
+// lastResult returns the reply of the last command of a batch.
+func lastResult[T int64 | float64](result []any, key string) (T, error) {
+	value, ok := result[len(result)-1].(T)
+	if !ok {
+		return 0, fmt.Errorf("unexpected type %T for key %s", result[len(result)-1], key)
+	}
+
+	return value, nil
+}
+
+func (c *glideCommon) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := c.cl.PTTL(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+
+	switch ttl {
+	case -2:
+		return 0, kv.ErrKeyNil
+	case -1:
+		return kv.NoExpiration, nil
+	}
+
+	return time.Duration(ttl) * time.Millisecond, nil
+}
+
+func (c *glideCommon) Expire(ctx context.Context, key string, d time.Duration) error {
+	ok, err := c.cl.PExpire(ctx, key, roundUpMs(d))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return kv.ErrKeyNil
+	}
+
+	return nil
+}
+
+func (c *glideCommon) ExpireAt(ctx context.Context, key string, t time.Time) error {
+	ok, err := c.cl.PExpireAt(ctx, key, time.UnixMilli(valueversion.UnixMilli(t)))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return kv.ErrKeyNil
+	}
+
+	return nil
+}
+
+func (c *glideCommon) Persist(ctx context.Context, key string) error {
+	ok, err := c.cl.Persist(ctx, key)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return nil
+	}
+
+	// PERSIST also reports false for keys without an expiration.
+	exists, err := c.Exists(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return kv.ErrKeyNil
+	}
+
+	return nil
+}
+
+// glideCompareAndSwapScript is created lazily, as glide scripts live in the native client library.
+var glideCompareAndSwapScript = sync.OnceValue(func() *options.Script {
+	return options.NewScript(valueversion.CompareAndSwapScript)
+})
+
+func (c *glideCommon) GetWithVersion(ctx context.Context, key string) (kv.Valuer, kv.Version) {
+	v := c.Get(ctx, key)
+	if v.Err() != nil {
+		return v, ""
+	}
+
+	b, _ := v.Bytes()
+	return v, kv.Version(valueversion.Of(b))
+}
+
+func (c *glideCommon) CompareAndSwap(
+	ctx context.Context,
+	key string,
+	version kv.Version,
+	value any,
+	options ...kvoptions.Option,
+) error {
+	o := kvoptions.Construct(options...)
+
+	bytes, err := c.opts.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	result, err := c.cl.InvokeScriptWithOptions(
+		ctx,
+		*glideCompareAndSwapScript(),
+		*newScriptOptions(
+			[]string{key},
+			[]string{string(version), string(bytes), valueversion.ExpireArg(o.Expire)},
+		),
+	)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	swapped, ok := result.(int64)
+	if !ok {
+		return fmt.Errorf("unexpected type %T for key %s", result, key)
 	}
+	if swapped == 0 {
+		return kv.ErrVersionMismatch
+	}
+
+	return nil
+}
 
-	return result.Data, nil
+func newScriptOptions(keys, args []string) *options.ScriptOptions {
+	return options.NewScriptOptions().WithKeys(keys).WithArgs(args)
 }
@@ -0,0 +1,123 @@
+package valkey
+
+import (
+	"context"
+	"iter"
+
+	"github.com/twirapp/kv"
+	kvoptions "github.com/twirapp/kv/options"
+	glide "github.com/valkey-io/valkey-glide/go/v2"
+	"github.com/valkey-io/valkey-glide/go/v2/models"
+	"github.com/valkey-io/valkey-glide/go/v2/options"
+	"github.com/valkey-io/valkey-glide/go/v2/pipeline"
+)
+
+var _ kv.KV = (*GlideClusterStore)(nil)
+var _ kv.CodecProvider = (*GlideClusterStore)(nil)
+
+// NewGlideCluster returns a store over a glide cluster client. The client splits multi-key
+// operations by hash slot, and key scans cover every primary of the cluster.
+func NewGlideCluster(client *glide.ClusterClient, options ...Option) *GlideClusterStore {
+	return &GlideClusterStore{
+		glideCommon: glideCommon{
+			cl:   client,
+			opts: constructOptions(options...),
+		},
+		client: client,
+	}
+}
+
+type GlideClusterStore struct {
+	glideCommon
+	client *glide.ClusterClient
+}
+
+func (c *GlideClusterStore) GetKeysByPattern(ctx context.Context, pattern string) ([]string, error) {
+	return collectKeys(c.ScanKeys(ctx, pattern))
+}
+
+// ScanKeys iterates over the keys matching pattern on every primary of the cluster.
+func (c *GlideClusterStore) ScanKeys(ctx context.Context, pattern string) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		opts := options.NewClusterScanOptions().SetMatch(pattern)
+		if c.opts.scanCount > 0 {
+			opts.SetCount(c.opts.scanCount)
+		}
+
+		for cursor := models.NewClusterScanCursor(); !cursor.IsFinished(); {
+			if err := ctx.Err(); err != nil {
+				yield("", err)
+				return
+			}
+
+			result, err := c.client.ScanWithOptions(ctx, cursor, *opts)
+			if err != nil {
+				yield("", err)
+				return
+			}
+
+			for _, key := range result.Keys {
+				if !yield(key, nil) {
+					return
+				}
+			}
+
+			cursor = result.Cursor
+		}
+	}
+}
+
+func (c *GlideClusterStore) DeleteByPattern(ctx context.Context, pattern string) (int64, error) {
+	return deleteByPattern(c.ScanKeys(ctx, pattern), func(keys []string) (int64, error) {
+		return c.cl.Unlink(ctx, keys)
+	})
+}
+
+func (c *GlideClusterStore) Incr(ctx context.Context, key string, options ...kvoptions.Option) (int64, error) {
+	return c.IncrBy(ctx, key, 1, options...)
+}
+
+func (c *GlideClusterStore) IncrBy(ctx context.Context, key string, delta int64, options ...kvoptions.Option) (int64, error) {
+	o := kvoptions.Construct(options...)
+	if o.Expire <= 0 {
+		return c.cl.IncrBy(ctx, key, delta)
+	}
+
+	batch := pipeline.NewClusterBatch(true)
+	addCounterInit(&batch.BaseBatch, key, o.Expire)
+	batch.IncrBy(key, delta)
+
+	result, err := c.client.Exec(ctx, *batch, true)
+	if err != nil {
+		return 0, err
+	}
+
+	return lastResult[int64](result, key)
+}
+
+func (c *GlideClusterStore) IncrByFloat(
+	ctx context.Context,
+	key string,
+	delta float64,
+	options ...kvoptions.Option,
+) (float64, error) {
+	o := kvoptions.Construct(options...)
+	if o.Expire <= 0 {
+		return c.cl.IncrByFloat(ctx, key, delta)
+	}
+
+	batch := pipeline.NewClusterBatch(true)
+	addCounterInit(&batch.BaseBatch, key, o.Expire)
+	batch.IncrByFloat(key, delta)
+
+	result, err := c.client.Exec(ctx, *batch, true)
+	if err != nil {
+		return 0, err
+	}
+
+	return lastResult[float64](result, key)
+}
+
+func (c *GlideClusterStore) Decr(ctx context.Context, key string, options ...kvoptions.Option) (int64, error) {
+	return c.IncrBy(ctx, key, -1, options...)
+}
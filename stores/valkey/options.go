@@ -0,0 +1,51 @@
+package valkey
+
+import (
+	"time"
+
+	kvcodec "github.com/twirapp/kv/codec"
+)
+
+type storeOptions struct {
+	scanCount      int64
+	codec          kvcodec.Codec
+	clientCacheTTL time.Duration
+}
+
+type Option func(*storeOptions)
+
+// WithScanCount sets the COUNT hint used for every SCAN page. Zero leaves the server default.
+func WithScanCount(count int64) Option {
+	return func(o *storeOptions) {
+		o.scanCount = count
+	}
+}
+
+// WithCodec sets the codec used to encode values. Defaults to kvcodec.Default.
+func WithCodec(codec kvcodec.Codec) Option {
+	return func(o *storeOptions) {
+		o.codec = codec
+	}
+}
+
+// WithClientCache makes ValkeyStore serve Get, GetMany, Exists and ExistsMany from the
+// server-assisted client-side cache of valkey-go (DoCache and DoMultiCache), keeping each
+// entry locally for at most ttl. The server invalidates cached entries when keys change,
+// so the client must use RESP3 with client-side caching enabled, which is the valkey-go default.
+// It is ignored by GlideStore.
+func WithClientCache(ttl time.Duration) Option {
+	return func(o *storeOptions) {
+		o.clientCacheTTL = ttl
+	}
+}
+
+func constructOptions(options ...Option) storeOptions {
+	opts := storeOptions{
+		codec: kvcodec.Default,
+	}
+	for _, o := range options {
+		o(&opts)
+	}
+
+	return opts
+}
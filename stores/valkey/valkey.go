@@ -3,28 +3,94 @@ package valkey
 import (
 	"context"
 	"errors"
+	"fmt"
+	"iter"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/twirapp/kv"
-	"github.com/twirapp/kv/internal/tobytes"
+	kvcodec "github.com/twirapp/kv/codec"
+	"github.com/twirapp/kv/internal/hashslot"
+	"github.com/twirapp/kv/internal/valueversion"
 	kvoptions "github.com/twirapp/kv/options"
 	kvvaluer "github.com/twirapp/kv/valuer"
 	"github.com/valkey-io/valkey-go"
 )
 
 var _ kv.KV = (*ValkeyStore)(nil)
+var _ kv.CodecProvider = (*ValkeyStore)(nil)
+var _ kv.TTLManyProvider = (*ValkeyStore)(nil)
 
-func New(client valkey.Client) *ValkeyStore {
+func New(client valkey.Client, options ...Option) *ValkeyStore {
 	return &ValkeyStore{
-		cl: client,
+		cl:   client,
+		opts: constructOptions(options...),
 	}
 }
 
+// Codec returns the codec used to encode values.
+func (c *ValkeyStore) Codec() kvcodec.Codec {
+	return c.opts.codec
+}
+
 type ValkeyStore struct {
-	cl valkey.Client
+	cl   valkey.Client
+	opts storeOptions
+
+	// primariesMu guards the primaries of the cluster topology last seen by primaries.
+	primariesMu  sync.Mutex
+	topology     string
+	primaryAddrs []string
+}
+
+// clientCache reports whether reads go through the client-side cache.
+func (c *ValkeyStore) clientCache() bool {
+	return c.opts.clientCacheTTL > 0
+}
+
+// cluster reports whether the client talks to a cluster, where multi-key commands must not
+// span hash slots and every primary holds a part of the keyspace.
+func (c *ValkeyStore) cluster() bool {
+	return c.cl.Mode() == valkey.ClientModeCluster
+}
+
+// keyGroups splits the indexes of keys into groups that a single multi-key command can address:
+// one group on a standalone client and one per hash slot on a cluster.
+func keyGroups(cluster bool, keys []string) [][]int {
+	if cluster {
+		return hashslot.Group(keys)
+	}
+
+	group := make([]int, len(keys))
+	for i := range keys {
+		group[i] = i
+	}
+
+	return [][]int{group}
+}
+
+// pick returns the keys at the given indexes.
+func pick(keys []string, indexes []int) []string {
+	picked := make([]string, len(indexes))
+	for i, idx := range indexes {
+		picked[i] = keys[idx]
+	}
+
+	return picked
 }
 
 func (c *ValkeyStore) Get(ctx context.Context, key string) kv.Valuer {
-	result, err := c.cl.Do(ctx, c.cl.B().Get().Key(key).Build()).AsBytes()
+	var resp valkey.ValkeyResult
+	if c.clientCache() {
+		resp = c.cl.DoCache(ctx, c.cl.B().Get().Key(key).Cache(), c.opts.clientCacheTTL)
+	} else {
+		resp = c.cl.Do(ctx, c.cl.B().Get().Key(key).Build())
+	}
+
+	result, err := resp.AsBytes()
 	if err != nil {
 		if errors.Is(err, valkey.Nil) {
 			return &kvvaluer.Valuer{Error: kv.ErrKeyNil}
@@ -35,60 +101,135 @@ func (c *ValkeyStore) Get(ctx context.Context, key string) kv.Valuer {
 	return &kvvaluer.Valuer{Value: result}
 }
 
+func (c *ValkeyStore) GetMany(ctx context.Context, keys []string) []kv.Valuer {
+	results := make([]kv.Valuer, len(keys))
+	if len(keys) == 0 {
+		return results
+	}
+
+	if c.clientCache() {
+		cmds := make([]valkey.CacheableTTL, len(keys))
+		for i, key := range keys {
+			cmds[i] = valkey.CT(c.cl.B().Get().Key(key).Cache(), c.opts.clientCacheTTL)
+		}
+
+		for i, resp := range c.cl.DoMultiCache(ctx, cmds...) {
+			value, err := resp.AsBytes()
+			switch {
+			case valkey.IsValkeyNil(err):
+				results[i] = &kvvaluer.Valuer{Error: kv.ErrKeyNil}
+			case err != nil:
+				results[i] = &kvvaluer.Valuer{Error: err}
+			default:
+				results[i] = &kvvaluer.Valuer{Value: value}
+			}
+		}
+
+		return results
+	}
+
+	groups := keyGroups(c.cluster(), keys)
+	cmds := make(valkey.Commands, len(groups))
+	for i, group := range groups {
+		cmds[i] = c.cl.B().Mget().Key(pick(keys, group)...).Build()
+	}
+
+	for g, resp := range c.cl.DoMulti(ctx, cmds...) {
+		group := groups[g]
+
+		messages, err := resp.ToArray()
+		if err != nil {
+			for _, idx := range group {
+				results[idx] = &kvvaluer.Valuer{Error: err}
+			}
+			continue
+		}
+
+		for i, m := range messages {
+			idx := group[i]
+
+			if m.IsNil() {
+				results[idx] = &kvvaluer.Valuer{Error: kv.ErrKeyNil}
+				continue
+			}
+
+			value, err := m.AsBytes()
+			if err != nil {
+				results[idx] = &kvvaluer.Valuer{Error: err}
+				continue
+			}
+
+			results[idx] = &kvvaluer.Valuer{Value: value}
+		}
+	}
+
+	return results
+}
+
 func (c *ValkeyStore) Set(ctx context.Context, key string, value any, options ...kvoptions.Option) error {
 	o := kvoptions.Construct(options...)
 
-	bytes, err := tobytes.ToBytes(value)
+	bytes, err := c.opts.codec.Marshal(value)
 	if err != nil {
 		return err
 	}
 
-	cmd := c.cl.B().Set().Key(key).Value(string(bytes))
-
-	var finalCmd valkey.Completed
-	if o.Expire > 0 {
-		finalCmd = cmd.Ex(o.Expire).Build()
-	} else {
-		finalCmd = cmd.Build()
-	}
-
-	err = c.cl.Do(ctx, finalCmd).Error()
+	err = c.cl.Do(ctx, c.setCommand(key, bytes, o)).Error()
 	if err != nil {
+		if valkey.IsValkeyNil(err) {
+			return kv.ErrNotSet
+		}
 		return err
 	}
 
 	return nil
 }
 
+func (c *ValkeyStore) setCommand(key string, value []byte, o kvoptions.Options) valkey.Completed {
+	cmd := c.cl.B().Set().Key(key).Value(string(value))
+	px := valueversion.Milliseconds(o.Expire)
+
+	switch {
+	case o.OnlyIfNotExists && o.Expire > 0:
+		return cmd.Nx().PxMilliseconds(px).Build()
+	case o.OnlyIfNotExists:
+		return cmd.Nx().Build()
+	case o.OnlyIfExists && o.Expire > 0:
+		return cmd.Xx().PxMilliseconds(px).Build()
+	case o.OnlyIfExists:
+		return cmd.Xx().Build()
+	case o.Expire > 0:
+		return cmd.PxMilliseconds(px).Build()
+	default:
+		return cmd.Build()
+	}
+}
+
+// SetMany attempts every value and returns the errors of all failed keys joined together,
+// including kv.ErrNotSet for unmet conditions.
 func (c *ValkeyStore) SetMany(ctx context.Context, values []kv.SetMany) error {
 	cmds := make(valkey.Commands, 0, len(values))
 	for _, v := range values {
-		o := kvoptions.Construct(v.Options...)
-
-		bytes, err := tobytes.ToBytes(v.Value)
+		bytes, err := c.opts.codec.Marshal(v.Value)
 		if err != nil {
 			return err
 		}
 
-		cmd := c.cl.B().Set().Key(v.Key).Value(string(bytes))
-
-		var finalCmd valkey.Completed
-		if o.Expire > 0 {
-			finalCmd = cmd.Ex(o.Expire).Build()
-		} else {
-			finalCmd = cmd.Build()
-		}
-
-		cmds = append(cmds, finalCmd)
+		cmds = append(cmds, c.setCommand(v.Key, bytes, kvoptions.Construct(v.Options...)))
 	}
 
-	for _, resp := range c.cl.DoMulti(ctx, cmds...) {
-		if err := resp.Error(); err != nil {
-			return err
+	var errs []error
+	for i, resp := range c.cl.DoMulti(ctx, cmds...) {
+		err := resp.Error()
+		if valkey.IsValkeyNil(err) {
+			err = kv.ErrNotSet
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to set key %s: %w", values[i].Key, err))
 		}
 	}
 
-	return nil
+	return errors.Join(errs...)
 }
 
 func (c *ValkeyStore) Delete(ctx context.Context, key string) error {
@@ -97,11 +238,30 @@ func (c *ValkeyStore) Delete(ctx context.Context, key string) error {
 }
 
 func (c *ValkeyStore) DeleteMany(ctx context.Context, keys []string) error {
-	err := c.cl.Do(ctx, c.cl.B().Del().Key(keys...).Build()).Error()
-	return err
+	if len(keys) == 0 {
+		return nil
+	}
+
+	groups := keyGroups(c.cluster(), keys)
+	cmds := make(valkey.Commands, len(groups))
+	for i, group := range groups {
+		cmds[i] = c.cl.B().Del().Key(pick(keys, group)...).Build()
+	}
+
+	for _, resp := range c.cl.DoMulti(ctx, cmds...) {
+		if err := resp.Error(); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 func (c *ValkeyStore) Exists(ctx context.Context, key string) (bool, error) {
+	if c.clientCache() {
+		return typeExists(c.cl.DoCache(ctx, c.cachedExists(key), c.opts.clientCacheTTL))
+	}
+
 	result, err := c.cl.Do(ctx, c.cl.B().Exists().Key(key).Build()).AsInt64()
 	if err != nil {
 		return false, err
@@ -110,6 +270,24 @@ func (c *ValkeyStore) Exists(ctx context.Context, key string) (bool, error) {
 }
 
 func (c *ValkeyStore) ExistsMany(ctx context.Context, keys []string) ([]bool, error) {
+	if c.clientCache() {
+		cmds := make([]valkey.CacheableTTL, 0, len(keys))
+		for _, key := range keys {
+			cmds = append(cmds, valkey.CT(c.cachedExists(key), c.opts.clientCacheTTL))
+		}
+
+		results := make([]bool, 0, len(keys))
+		for _, resp := range c.cl.DoMultiCache(ctx, cmds...) {
+			exists, err := typeExists(resp)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, exists)
+		}
+
+		return results, nil
+	}
+
 	cmds := make(valkey.Commands, 0, len(keys))
 	for _, key := range keys {
 		cmd := c.cl.B().Exists().Key(key)
@@ -128,10 +306,422 @@ func (c *ValkeyStore) ExistsMany(ctx context.Context, keys []string) ([]bool, er
 	return results, nil
 }
 
+// cachedExists returns a cacheable command telling whether key exists. EXISTS cannot be
+// cached, so TYPE is used instead: it returns "none" for missing keys.
+func (c *ValkeyStore) cachedExists(key string) valkey.Cacheable {
+	return c.cl.B().Type().Key(key).Cache()
+}
+
+func typeExists(resp valkey.ValkeyResult) (bool, error) {
+	t, err := resp.ToString()
+	if err != nil {
+		return false, err
+	}
+
+	return t != "none", nil
+}
+
 func (c *ValkeyStore) GetKeysByPattern(ctx context.Context, pattern string) ([]string, error) {
-	result, err := c.cl.Do(ctx, c.cl.B().Scan().Cursor(0).Match(pattern).Build()).AsScanEntry()
+	return collectKeys(c.ScanKeys(ctx, pattern))
+}
+
+func collectKeys(seq iter.Seq2[string, error]) ([]string, error) {
+	var keys []string
+
+	for key, err := range seq {
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// ScanKeys iterates over the keys matching pattern. On a cluster every primary is scanned
+// in turn, so the keys of all nodes are returned.
+func (c *ValkeyStore) ScanKeys(ctx context.Context, pattern string) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		if !c.cluster() {
+			c.scanNode(ctx, c.cl, pattern, yield)
+			return
+		}
+
+		nodes, err := c.primaries(ctx)
+		if err != nil {
+			yield("", err)
+			return
+		}
+
+		for _, node := range nodes {
+			if !c.scanNode(ctx, node, pattern, yield) {
+				return
+			}
+		}
+	}
+}
+
+// primaries returns a client for every primary of the cluster, ordered by address.
+// The client does not expose node roles, so they are queried with ROLE once per topology
+// and reused until the set of nodes known to the client changes.
+func (c *ValkeyStore) primaries(ctx context.Context) ([]valkey.Client, error) {
+	nodes := c.cl.Nodes()
+	addrs := slices.Sorted(maps.Keys(nodes))
+	topology := strings.Join(addrs, ",")
+
+	c.primariesMu.Lock()
+	defer c.primariesMu.Unlock()
+
+	if c.topology != topology {
+		primaryAddrs, err := primaryAddrs(ctx, nodes, addrs)
+		if err != nil {
+			return nil, err
+		}
+
+		c.topology, c.primaryAddrs = topology, primaryAddrs
+	}
+
+	primaries := make([]valkey.Client, len(c.primaryAddrs))
+	for i, addr := range c.primaryAddrs {
+		primaries[i] = nodes[addr]
+	}
+
+	return primaries, nil
+}
+
+// primaryAddrs returns the addresses of the nodes reporting the master role.
+func primaryAddrs(ctx context.Context, nodes map[string]valkey.Client, addrs []string) ([]string, error) {
+	var primaries []string
+	for _, addr := range addrs {
+		node := nodes[addr]
+
+		role, err := node.Do(ctx, node.B().Role().Build()).ToArray()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get role of node %s: %w", addr, err)
+		}
+		if len(role) == 0 {
+			return nil, fmt.Errorf("empty role reply from node %s", addr)
+		}
+
+		if name, _ := role[0].ToString(); name == "master" {
+			primaries = append(primaries, addr)
+		}
+	}
+
+	return primaries, nil
+}
+
+// scanNode passes the keys of node matching pattern to yield. It reports whether the
+// iteration should continue with the next node.
+func (c *ValkeyStore) scanNode(
+	ctx context.Context,
+	node valkey.Client,
+	pattern string,
+	yield func(string, error) bool,
+) bool {
+	var cursor uint64
+
+	for {
+		if err := ctx.Err(); err != nil {
+			yield("", err)
+			return false
+		}
+
+		cmd := node.B().Scan().Cursor(cursor).Match(pattern)
+
+		var finalCmd valkey.Completed
+		if c.opts.scanCount > 0 {
+			finalCmd = cmd.Count(c.opts.scanCount).Build()
+		} else {
+			finalCmd = cmd.Build()
+		}
+
+		result, err := node.Do(ctx, finalCmd).AsScanEntry()
+		if err != nil {
+			yield("", err)
+			return false
+		}
+
+		for _, key := range result.Elements {
+			if !yield(key, nil) {
+				return false
+			}
+		}
+
+		cursor = result.Cursor
+		if cursor == 0 {
+			return true
+		}
+	}
+}
+
+func (c *ValkeyStore) DeleteByPattern(ctx context.Context, pattern string) (int64, error) {
+	return deleteByPattern(c.ScanKeys(ctx, pattern), func(keys []string) (int64, error) {
+		groups := keyGroups(c.cluster(), keys)
+		cmds := make(valkey.Commands, len(groups))
+		for i, group := range groups {
+			cmds[i] = c.cl.B().Unlink().Key(pick(keys, group)...).Build()
+		}
+
+		var deleted int64
+		for _, resp := range c.cl.DoMulti(ctx, cmds...) {
+			n, err := resp.AsInt64()
+			if err != nil {
+				return deleted, err
+			}
+			deleted += n
+		}
+
+		return deleted, nil
+	})
+}
+
+// deleteBatchSize is the number of scanned keys removed by a single UNLINK in DeleteByPattern.
+const deleteBatchSize = 500
+
+// deleteByPattern streams keys into batches of deleteBatchSize and passes every batch to unlink.
+func deleteByPattern(keys iter.Seq2[string, error], unlink func([]string) (int64, error)) (int64, error) {
+	var (
+		deleted int64
+		batch   = make([]string, 0, deleteBatchSize)
+	)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		n, err := unlink(batch)
+		if err != nil {
+			return err
+		}
+
+		deleted += n
+		batch = batch[:0]
+
+		return nil
+	}
+
+	for key, err := range keys {
+		if err != nil {
+			return deleted, err
+		}
+
+		batch = append(batch, key)
+		if len(batch) == deleteBatchSize {
+			if err := flush(); err != nil {
+				return deleted, err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return deleted, err
+	}
+
+	return deleted, nil
+}
+
+func (c *ValkeyStore) Incr(ctx context.Context, key string, options ...kvoptions.Option) (int64, error) {
+	return c.IncrBy(ctx, key, 1, options...)
+}
+
+func (c *ValkeyStore) IncrBy(ctx context.Context, key string, delta int64, options ...kvoptions.Option) (int64, error) {
+	incr := c.cl.B().Incrby().Key(key).Increment(delta).Build()
+
+	resp, err := c.doCounter(ctx, key, incr, options...)
+	if err != nil {
+		return 0, err
+	}
+
+	return resp.AsInt64()
+}
+
+func (c *ValkeyStore) IncrByFloat(
+	ctx context.Context,
+	key string,
+	delta float64,
+	options ...kvoptions.Option,
+) (float64, error) {
+	incr := c.cl.B().Incrbyfloat().Key(key).Increment(delta).Build()
+
+	resp, err := c.doCounter(ctx, key, incr, options...)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	return result.Elements, nil
+
+	return resp.AsFloat64()
+}
+
+func (c *ValkeyStore) Decr(ctx context.Context, key string, options ...kvoptions.Option) (int64, error) {
+	return c.IncrBy(ctx, key, -1, options...)
+}
+
+// doCounter runs an increment command. If an expiration is requested, the key is
+// created with it inside the same transaction, so the TTL is applied only on creation.
+func (c *ValkeyStore) doCounter(
+	ctx context.Context,
+	key string,
+	incr valkey.Completed,
+	options ...kvoptions.Option,
+) (valkey.ValkeyMessage, error) {
+	o := kvoptions.Construct(options...)
+	if o.Expire <= 0 {
+		return c.cl.Do(ctx, incr).ToMessage()
+	}
+
+	resps := c.cl.DoMulti(
+		ctx,
+		c.cl.B().Multi().Build(),
+		c.cl.B().Set().Key(key).Value("0").Nx().PxMilliseconds(valueversion.Milliseconds(o.Expire)).Build(),
+		incr,
+		c.cl.B().Exec().Build(),
+	)
+	for _, resp := range resps {
+		if err := resp.Error(); err != nil && !valkey.IsValkeyNil(err) {
+			return valkey.ValkeyMessage{}, err
+		}
+	}
+
+	results, err := resps[len(resps)-1].ToArray()
+	if err != nil {
+		return valkey.ValkeyMessage{}, err
+	}
+	if len(results) != 2 {
+		return valkey.ValkeyMessage{}, fmt.Errorf("unexpected transaction result length %d", len(results))
+	}
+
+	return results[1], nil
+}
+
+func (c *ValkeyStore) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := c.cl.Do(ctx, c.cl.B().Pttl().Key(key).Build()).AsInt64()
+	if err != nil {
+		return 0, err
+	}
+
+	switch ttl {
+	case -2:
+		return 0, kv.ErrKeyNil
+	case -1:
+		return kv.NoExpiration, nil
+	}
+
+	return time.Duration(ttl) * time.Millisecond, nil
+}
+
+func (c *ValkeyStore) TTLMany(ctx context.Context, keys []string) ([]time.Duration, error) {
+	results := make([]time.Duration, len(keys))
+	if len(keys) == 0 {
+		return results, nil
+	}
+
+	cmds := make(valkey.Commands, len(keys))
+	for i, key := range keys {
+		cmds[i] = c.cl.B().Pttl().Key(key).Build()
+	}
+
+	for i, resp := range c.cl.DoMulti(ctx, cmds...) {
+		ttl, err := resp.AsInt64()
+		if err != nil {
+			return nil, err
+		}
+
+		switch ttl {
+		case -2:
+		case -1:
+			results[i] = kv.NoExpiration
+		default:
+			results[i] = time.Duration(ttl) * time.Millisecond
+		}
+	}
+
+	return results, nil
+}
+
+func (c *ValkeyStore) Expire(ctx context.Context, key string, d time.Duration) error {
+	ok, err := c.cl.Do(ctx, c.cl.B().Pexpire().Key(key).Milliseconds(valueversion.Milliseconds(d)).Build()).AsBool()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return kv.ErrKeyNil
+	}
+
+	return nil
+}
+
+func (c *ValkeyStore) ExpireAt(ctx context.Context, key string, t time.Time) error {
+	ok, err := c.cl.Do(ctx, c.cl.B().Pexpireat().Key(key).MillisecondsTimestamp(valueversion.UnixMilli(t)).Build()).AsBool()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return kv.ErrKeyNil
+	}
+
+	return nil
+}
+
+func (c *ValkeyStore) Persist(ctx context.Context, key string) error {
+	ok, err := c.cl.Do(ctx, c.cl.B().Persist().Key(key).Build()).AsBool()
+	if err != nil {
+		return err
+	}
+	if ok {
+		return nil
+	}
+
+	// PERSIST also reports false for keys without an expiration.
+	exists, err := c.Exists(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return kv.ErrKeyNil
+	}
+
+	return nil
+}
+
+var compareAndSwapScript = valkey.NewLuaScript(valueversion.CompareAndSwapScript)
+
+func (c *ValkeyStore) GetWithVersion(ctx context.Context, key string) (kv.Valuer, kv.Version) {
+	v := c.Get(ctx, key)
+	if v.Err() != nil {
+		return v, ""
+	}
+
+	b, _ := v.Bytes()
+	return v, kv.Version(valueversion.Of(b))
+}
+
+func (c *ValkeyStore) CompareAndSwap(
+	ctx context.Context,
+	key string,
+	version kv.Version,
+	value any,
+	options ...kvoptions.Option,
+) error {
+	o := kvoptions.Construct(options...)
+
+	bytes, err := c.opts.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	swapped, err := compareAndSwapScript.Exec(
+		ctx,
+		c.cl,
+		[]string{key},
+		[]string{string(version), string(bytes), valueversion.ExpireArg(o.Expire)},
+	).AsInt64()
+	if err != nil {
+		return err
+	}
+	if swapped == 0 {
+		return kv.ErrVersionMismatch
+	}
+
+	return nil
 }
@@ -0,0 +1,72 @@
+package kv
+
+import (
+	"context"
+
+	kvcodec "github.com/twirapp/kv/codec"
+	kvoptions "github.com/twirapp/kv/options"
+)
+
+// CodecProvider is implemented by stores that encode values with a configurable codec.
+// The typed helpers use it to decode values the same way the store encoded them.
+type CodecProvider interface {
+	Codec() kvcodec.Codec
+}
+
+// CodecOf returns the codec used by store, or kvcodec.Default if the store does not
+// implement CodecProvider.
+func CodecOf(store KV) kvcodec.Codec {
+	if p, ok := store.(CodecProvider); ok {
+		if c := p.Codec(); c != nil {
+			return c
+		}
+	}
+
+	return kvcodec.Default
+}
+
+// GetAs returns the value stored under key decoded into T.
+// Scalars, strings, bools and time values are parsed directly, structs are decoded with
+// kvscanner.Scan and anything else is decoded as JSON.
+// It returns ErrKeyNil if the key does not exist.
+func GetAs[T any](ctx context.Context, store KV, key string) (T, error) {
+	return decodeAs[T](CodecOf(store), store.Get(ctx, key))
+}
+
+// GetManyAs returns the values stored under keys decoded into T.
+// The order of values and errors corresponds to the order of the keys provided;
+// a missing key yields the zero value of T and ErrKeyNil at its position.
+func GetManyAs[T any](ctx context.Context, store KV, keys []string) ([]T, []error) {
+	codec := CodecOf(store)
+	valuers := store.GetMany(ctx, keys)
+
+	values := make([]T, len(valuers))
+	errs := make([]error, len(valuers))
+	for i, v := range valuers {
+		values[i], errs[i] = decodeAs[T](codec, v)
+	}
+
+	return values, errs
+}
+
+// SetAs stores value under key using the store's codec.
+// It behaves like Set, but only accepts values of type T.
+func SetAs[T any](ctx context.Context, store KV, key string, value T, options ...kvoptions.Option) error {
+	return store.Set(ctx, key, value, options...)
+}
+
+func decodeAs[T any](codec kvcodec.Codec, v Valuer) (T, error) {
+	var result T
+
+	data, err := v.Bytes()
+	if err != nil {
+		return result, err
+	}
+
+	if err := codec.Unmarshal(data, &result); err != nil {
+		var zero T
+		return zero, err
+	}
+
+	return result, nil
+}
@@ -7,17 +7,22 @@ import (
 	kvscanner "github.com/twirapp/kv/scanner"
 )
 
-var _ kv.Valuer = (*Valuer)(nil)
+var _ kv.StaleValuer = (*Valuer)(nil)
 
 type Valuer struct {
 	Value []byte
 	Error error
+	Stale bool
 }
 
 func (v *Valuer) Err() error {
 	return v.Error
 }
 
+func (v *Valuer) IsStale() bool {
+	return v.Stale
+}
+
 func (v *Valuer) Int() (int64, error) {
 	if v.Error != nil {
 		return 0, v.Error